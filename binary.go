@@ -0,0 +1,524 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+var tableauMagic = []byte("CSWT")
+
+const tableauVersion = 5
+
+// EncodeTableau encodes the solved state of the Solver (constraints, edit variables, stays, objectives and rows)
+// in a compact binary format. DecodeTableau turns it back into a ready to use Solver without pivoting.
+// Variables are identified by their names, so names have to be unique.
+func EncodeTableau(s *Solver) ([]byte, error) {
+	w := &tableauWriter{symbols: make(map[*internal.Symbol]uint64)}
+
+	constraints := s.orderedConstraints()
+
+	variables := make([]*Variable, 0, len(s.variables))
+	variableIDs := make(map[*Variable]uint64, len(s.variables))
+	addVariable := func(v *Variable) {
+		if _, ok := variableIDs[v]; !ok {
+			variableIDs[v] = uint64(len(variables))
+			variables = append(variables, v)
+		}
+	}
+	for _, constraint := range constraints {
+		for _, term := range constraint.expression.terms {
+			addVariable(term.variable)
+		}
+	}
+	remaining := make([]*Variable, 0)
+	for v := range s.variables {
+		if _, ok := variableIDs[v]; !ok {
+			remaining = append(remaining, v)
+		}
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].Name < remaining[j].Name
+	})
+	for _, v := range remaining {
+		addVariable(v)
+	}
+
+	names := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		if v.Name == "" {
+			continue
+		}
+		if names[v.Name] {
+			return nil, errors.Errorf("Duplicate variable name %q", v.Name)
+		}
+		names[v.Name] = true
+	}
+
+	// symbols are numbered in the order they are encountered, so the output is deterministic
+	for _, v := range variables {
+		if symbol, ok := s.variables[v]; ok {
+			w.symbol(symbol)
+		}
+	}
+	for _, constraint := range constraints {
+		tag := s.constraints[constraint]
+		w.symbol(tag.Marker)
+		w.symbol(tag.Other)
+	}
+	for symbol := range s.rows {
+		w.symbol(symbol)
+	}
+	symbolTypes := make([]internal.SymbolType, len(w.symbols))
+	for symbol, id := range w.symbols {
+		symbolTypes[id] = symbol.Type
+	}
+
+	w.buf.Write(tableauMagic)
+	w.uvarint(tableauVersion)
+	w.bool(s.hierarchical)
+	w.bool(s.rejectRedundant)
+	if s.quadratic != nil {
+		w.float(s.quadratic.step)
+		w.uvarint(uint64(s.quadratic.segments))
+	} else {
+		w.float(0)
+		w.uvarint(0)
+	}
+
+	w.uvarint(uint64(len(symbolTypes)))
+	for _, symbolType := range symbolTypes {
+		w.uvarint(uint64(symbolType))
+	}
+
+	w.uvarint(uint64(len(variables)))
+	for _, v := range variables {
+		w.string(v.Name)
+		w.float(v.Value)
+		w.bool(v.Integral)
+		if symbol, ok := s.variables[v]; ok {
+			w.bool(true)
+			w.uvarint(w.symbols[symbol])
+		} else {
+			w.bool(false)
+		}
+	}
+
+	constraintIDs := make(map[*Constraint]uint64, len(constraints))
+	w.uvarint(uint64(len(constraints)))
+	for i, constraint := range constraints {
+		constraintIDs[constraint] = uint64(i)
+
+		w.uvarint(uint64(constraint.relation))
+		w.varint(int64(constraint.Priority))
+		w.float(constraint.expression.constant)
+		w.terms(constraint.expression, variableIDs)
+
+		tag := s.constraints[constraint]
+		w.uvarint(w.symbols[tag.Marker])
+		w.uvarint(w.symbols[tag.Other])
+	}
+
+	objectives := s.orderedObjectives()
+	w.uvarint(uint64(len(objectives)))
+	for _, objective := range objectives {
+		w.varint(int64(objective.priority))
+		w.bool(objective.maximize)
+		w.float(objective.expression.constant)
+		w.terms(objective.expression, variableIDs)
+	}
+
+	w.edits(s.edits, variableIDs, constraintIDs)
+	w.edits(s.stays, variableIDs, constraintIDs)
+
+	basic := make([]*internal.Symbol, 0, len(s.rows))
+	for symbol := range s.rows {
+		basic = append(basic, symbol)
+	}
+	sort.Slice(basic, func(i, j int) bool {
+		return w.symbols[basic[i]] < w.symbols[basic[j]]
+	})
+	w.uvarint(uint64(len(basic)))
+	for _, symbol := range basic {
+		w.uvarint(w.symbols[symbol])
+		w.row(s.rows[symbol])
+	}
+
+	w.row(s.objective)
+
+	priorities := s.levelPriorities()
+	w.uvarint(uint64(len(priorities)))
+	for _, priority := range priorities {
+		w.varint(int64(priority))
+		w.row(s.levels[priority])
+	}
+
+	w.uvarint(uint64(len(s.redundancies)))
+	for _, redundancy := range s.redundancies {
+		w.uvarint(constraintIDs[redundancy.Constraint])
+		w.uvarint(uint64(len(redundancy.ImpliedBy)))
+		for _, other := range redundancy.ImpliedBy {
+			w.uvarint(constraintIDs[other])
+		}
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// DecodeTableau creates a Solver from data written by EncodeTableau. Variables are taken from the given
+// map by their names and get the encoded Integral flag, all other variables are created anew. All
+// variables and the constraints which are not part of edit variables or stays are returned in the order
+// they were encoded.
+func DecodeTableau(data []byte, variables map[string]*Variable) (*Solver, []*Variable, []*Constraint, error) {
+	r := &tableauReader{r: bytes.NewReader(data)}
+
+	magic := make([]byte, len(tableauMagic))
+	if _, err := io.ReadFull(r.r, magic); err != nil || !bytes.Equal(magic, tableauMagic) {
+		return nil, nil, nil, errors.New("Not an encoded tableau")
+	}
+	if version := r.uvarint(); r.err == nil && version != tableauVersion {
+		return nil, nil, nil, errors.Errorf("Unsupported version %d", version)
+	}
+
+	s := NewSolver()
+	if r.bool() {
+		s = NewHierarchicalSolver()
+	}
+	s.rejectRedundant = r.bool()
+	if step, segments := r.float(), r.uvarint(); segments > 0 {
+		s.quadratic = &quadraticMode{step: step, segments: int(segments)}
+	}
+
+	r.symbols = make([]*internal.Symbol, r.count())
+	for i := range r.symbols {
+		symbolType := internal.SymbolType(r.uvarint())
+		if symbolType < internal.Invalid || symbolType > internal.Dummy {
+			r.fail(errors.Errorf("Unknown symbol type %d", symbolType))
+		}
+		r.symbols[i] = &internal.Symbol{Type: symbolType}
+	}
+
+	decoded := make([]*Variable, r.count())
+	for i := range decoded {
+		name := r.string()
+		value := r.float()
+		integral := r.bool()
+
+		v, ok := variables[name]
+		if name == "" || !ok {
+			v = NewParam(value).Variable
+			v.Name = name
+		}
+		v.Integral = integral
+		decoded[i] = v
+
+		if r.bool() {
+			s.registerVariable(v, r.symbol())
+		}
+	}
+	variable := func() *Variable {
+		id := r.uvarint()
+		if id >= uint64(len(decoded)) {
+			r.fail(errors.Errorf("Unknown variable id %d", id))
+			return nil
+		}
+		return decoded[id]
+	}
+
+	constraints := make([]*Constraint, r.count())
+	for i := range constraints {
+		relation := Relation(r.uvarint())
+		priority := Priority(r.varint())
+		constant := r.float()
+
+		constraint := NewConstraint(r.expression(constant, variable), relation)
+		constraint.Priority = priority
+		constraints[i] = constraint
+
+		s.constraints[constraint] = &internal.Tag{
+			Marker: r.symbol(),
+			Other:  r.symbol(),
+		}
+		s.order[constraint] = s.nextOrder
+		s.nextOrder++
+	}
+	constraint := func() *Constraint {
+		id := r.uvarint()
+		if id >= uint64(len(constraints)) {
+			r.fail(errors.Errorf("Unknown constraint id %d", id))
+			return nil
+		}
+		return constraints[id]
+	}
+
+	for i, count := 0, r.count(); i < count; i++ {
+		objective := &Objective{priority: Priority(r.varint())}
+		objective.maximize = r.bool()
+		objective.expression = r.expression(r.float(), variable)
+
+		s.goals[objective] = s.nextOrder
+		s.nextOrder++
+	}
+
+	r.edits(s, s.edits, variable, constraint)
+	r.edits(s, s.stays, variable, constraint)
+
+	for i, count := 0, r.count(); i < count; i++ {
+		symbol := r.symbol()
+		s.rows[symbol] = r.row()
+	}
+
+	s.objective = r.row()
+
+	if count := r.count(); !s.hierarchical && count > 0 {
+		r.fail(errors.New("Objective levels of a solver which is not hierarchical"))
+	} else {
+		for i := 0; i < count; i++ {
+			priority := Priority(r.varint())
+			s.levels[priority] = r.row()
+		}
+	}
+
+	for i, count := 0, r.count(); i < count; i++ {
+		redundancy := &Redundancy{Constraint: constraint()}
+		redundancy.ImpliedBy = make([]*Constraint, r.count())
+		for j := range redundancy.ImpliedBy {
+			redundancy.ImpliedBy[j] = constraint()
+		}
+		s.redundancies = append(s.redundancies, redundancy)
+	}
+
+	if r.err != nil {
+		return nil, nil, nil, errors.Wrap(r.err, "Could not decode tableau")
+	}
+	if r.r.Len() != 0 {
+		return nil, nil, nil, errors.New("Unexpected data after tableau")
+	}
+
+	s.infeasibleRows = list.New()
+	s.countReferences()
+
+	internalConstraints := s.internalConstraints()
+	result := make([]*Constraint, 0, len(constraints))
+	for _, constraint := range constraints {
+		if !internalConstraints[constraint] {
+			result = append(result, constraint)
+		}
+	}
+	return s, decoded, result, nil
+}
+
+type tableauWriter struct {
+	buf     bytes.Buffer
+	symbols map[*internal.Symbol]uint64
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *tableauWriter) uvarint(value uint64) {
+	n := binary.PutUvarint(w.scratch[:], value)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *tableauWriter) varint(value int64) {
+	n := binary.PutVarint(w.scratch[:], value)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *tableauWriter) float(value float64) {
+	binary.LittleEndian.PutUint64(w.scratch[:8], math.Float64bits(value))
+	w.buf.Write(w.scratch[:8])
+}
+
+func (w *tableauWriter) bool(value bool) {
+	if value {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *tableauWriter) string(value string) {
+	w.uvarint(uint64(len(value)))
+	w.buf.WriteString(value)
+}
+
+func (w *tableauWriter) symbol(symbol *internal.Symbol) uint64 {
+	id, ok := w.symbols[symbol]
+	if !ok {
+		id = uint64(len(w.symbols))
+		w.symbols[symbol] = id
+	}
+	return id
+}
+
+func (w *tableauWriter) row(row *internal.Row) {
+	cells := make([]*internal.Symbol, 0, len(row.Cells))
+	for symbol := range row.Cells {
+		cells = append(cells, symbol)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		return w.symbols[cells[i]] < w.symbols[cells[j]]
+	})
+
+	w.float(row.Constant)
+	w.uvarint(uint64(len(cells)))
+	for _, symbol := range cells {
+		w.uvarint(w.symbols[symbol])
+		w.float(row.Cells[symbol])
+	}
+}
+
+func (w *tableauWriter) terms(expression *Expression, variableIDs map[*Variable]uint64) {
+	w.uvarint(uint64(len(expression.terms)))
+	for _, term := range expression.terms {
+		w.uvarint(variableIDs[term.variable])
+		w.float(term.coefficient)
+	}
+}
+
+// edits writes the edit variables or stays ordered by variable id
+func (w *tableauWriter) edits(infos map[*Variable]*editInfo, variableIDs map[*Variable]uint64, constraintIDs map[*Constraint]uint64) {
+	edited := make([]*Variable, 0, len(infos))
+	for v := range infos {
+		edited = append(edited, v)
+	}
+	sort.Slice(edited, func(i, j int) bool {
+		return variableIDs[edited[i]] < variableIDs[edited[j]]
+	})
+	w.uvarint(uint64(len(edited)))
+	for _, v := range edited {
+		info := infos[v]
+		w.uvarint(variableIDs[v])
+		w.uvarint(constraintIDs[info.constraint])
+		w.float(info.constant)
+		w.uvarint(uint64(len(info.bands)))
+		for _, band := range info.bands {
+			w.uvarint(constraintIDs[band])
+		}
+	}
+}
+
+// tableauReader decodes the values written by tableauWriter. The first error is kept and all
+// further reads return zero values.
+type tableauReader struct {
+	r       *bytes.Reader
+	symbols []*internal.Symbol
+	err     error
+}
+
+func (r *tableauReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *tableauReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(r.r)
+	r.fail(err)
+	return value
+}
+
+func (r *tableauReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(r.r)
+	r.fail(err)
+	return value
+}
+
+// count reads a number of following entries, which can never exceed the remaining data
+func (r *tableauReader) count() int {
+	value := r.uvarint()
+	if value > uint64(r.r.Len()) {
+		r.fail(errors.Errorf("Bad count %d", value))
+		return 0
+	}
+	return int(value)
+}
+
+func (r *tableauReader) float() float64 {
+	if r.err != nil {
+		return 0
+	}
+	var buf [8]byte
+	_, err := io.ReadFull(r.r, buf[:])
+	r.fail(err)
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+}
+
+func (r *tableauReader) bool() bool {
+	if r.err != nil {
+		return false
+	}
+	value, err := r.r.ReadByte()
+	r.fail(err)
+	return value != 0
+}
+
+func (r *tableauReader) string() string {
+	buf := make([]byte, r.count())
+	if r.err != nil {
+		return ""
+	}
+	_, err := io.ReadFull(r.r, buf)
+	r.fail(err)
+	return string(buf)
+}
+
+func (r *tableauReader) symbol() *internal.Symbol {
+	id := r.uvarint()
+	if id >= uint64(len(r.symbols)) {
+		r.fail(errors.Errorf("Unknown symbol id %d", id))
+		return &internal.Symbol{Type: internal.Invalid}
+	}
+	return r.symbols[id]
+}
+
+func (r *tableauReader) expression(constant float64, variable func() *Variable) *Expression {
+	terms := make([]*Term, r.count())
+	for i := range terms {
+		terms[i] = NewTerm(variable(), r.float())
+	}
+	return NewExpression(terms, constant)
+}
+
+// edits reads the edit variables or stays written by tableauWriter.edits into infos
+func (r *tableauReader) edits(s *Solver, infos map[*Variable]*editInfo, variable func() *Variable, constraint func() *Constraint) {
+	for i, count := 0, r.count(); i < count; i++ {
+		v := variable()
+		c := constraint()
+		info := &editInfo{
+			tag:        s.constraints[c],
+			constraint: c,
+			constant:   r.float(),
+		}
+		info.bands = make([]*Constraint, r.count())
+		for j := range info.bands {
+			info.bands[j] = constraint()
+		}
+		infos[v] = info
+	}
+}
+
+func (r *tableauReader) row() *internal.Row {
+	row := internal.NewRow(r.float())
+	for i, count := 0, r.count(); i < count; i++ {
+		symbol := r.symbol()
+		row.Cells[symbol] = r.float()
+	}
+	return row
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"math"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// Bounds returns the minimum and maximum value the variable can take without violating any required
+// constraint. Soft constraints and edit variables are ignored. Missing bounds are reported as -Inf and +Inf.
+// The Solver is only read, the bounds are computed on a copy of its tableau.
+func (s *Solver) Bounds(v *Variable) (float64, float64, error) {
+	symbol, ok := s.variables[v]
+	if !ok {
+		return 0, 0, errors.New("Unknown variable")
+	}
+
+	min, ok := s.extremum(symbol, 1.0)
+	if !ok {
+		min = math.Inf(-1)
+	}
+
+	max, ok := s.extremum(symbol, -1.0)
+	if !ok {
+		max = math.Inf(1)
+	}
+
+	return min, max, nil
+}
+
+// extremum minimizes sign*symbol and returns the value of the symbol at the optimum. It returns false
+// if there is no optimum. The pivots are applied to a copy of the rows, so the Solver is left untouched.
+// The queried symbol is unrestricted, so external symbols may be moved in both directions.
+func (s *Solver) extremum(symbol *internal.Symbol, sign float64) (float64, bool) {
+	rows := make(map[*internal.Symbol]*internal.Row, len(s.rows))
+	for basic, row := range s.rows {
+		rows[basic] = internal.CopyRow(row)
+	}
+
+	objective := internal.NewRow(0.0)
+	if row, ok := rows[symbol]; ok {
+		objective.InsertRow(row, sign)
+	} else {
+		objective.InsertSymbol(symbol, sign)
+	}
+
+	for {
+		entering := s.enteringSymbolForObjectiveRow(objective, true, nil)
+		if entering.Type == internal.Invalid {
+			break
+		}
+
+		direction := 1.0
+		if objective.CoefficientForSymbol(entering) > 0.0 {
+			direction = -1.0
+		}
+
+		leaving := leavingSymbolWithinRows(rows, entering, direction)
+		if leaving == nil {
+			return 0, false
+		}
+
+		row := rows[leaving]
+		delete(rows, leaving)
+		row.SolveForSymbols(leaving, entering)
+		for _, other := range rows {
+			other.Substitute(entering, row)
+		}
+		objective.Substitute(entering, row)
+		rows[entering] = row
+	}
+
+	if row, ok := rows[symbol]; ok {
+		return row.Constant, true
+	}
+	return 0, true
+}
@@ -5,8 +5,15 @@
 package cassowary
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/monkey-works/cassowary/internal"
 )
 
 func TestParam(t *testing.T) {
@@ -546,3 +553,1882 @@ func TestSolutionWithOptiomize(t *testing.T) {
 		t.Error("P3 value does not match expected one ", 10, ", was", p3.Value())
 	}
 }
+
+func TestRedundantConstraint(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+
+	c1 := right.Sub(left).Equals(width)
+	c2 := width.Equals(CM(100))
+	c3 := right.Sub(left).Equals(CM(100))
+
+	s := NewSolver()
+	if err := s.AddConstraints(c1, c2, c3); err != nil {
+		t.Error(err)
+	}
+
+	redundancies := s.Redundancies()
+	if len(redundancies) != 1 {
+		t.Fatal("Redundancy count does not match expected one", 1, ", was", len(redundancies))
+	}
+	if redundancies[0].Constraint != c3 {
+		t.Error("Redundant constraint does not match expected one")
+	}
+	if len(redundancies[0].ImpliedBy) != 2 {
+		t.Error("Implying constraint count does not match expected one", 2, ", was", len(redundancies[0].ImpliedBy))
+	}
+	if implied := redundancies[0].ImpliedBy; implied[0] != c1 || implied[1] != c2 {
+		t.Error("Implying constraints should be ordered like they were added")
+	}
+
+	s.RemoveConstraint(c2)
+	if len(s.Redundancies()) != 0 {
+		t.Error("Redundancy should have been dropped with its implying constraint")
+	}
+}
+
+func TestRejectRedundantConstraint(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+
+	s := NewSolver()
+	s.SetRejectRedundant(true)
+	s.AddConstraint(right.Sub(left).Equals(CM(100)))
+
+	err := s.AddConstraint(right.Sub(left).Equals(CM(100)))
+	if _, ok := err.(*RedundancyError); !ok {
+		t.Error("Expected redundancy error, was", err)
+	}
+
+	if err := s.AddConstraint(right.Sub(left).Equals(CM(50))); err == nil {
+		t.Error("Conflicting constraint should not be satisfiable")
+	}
+}
+
+func TestSetConstraintPriority(t *testing.T) {
+	x := NewParam(0)
+
+	c1 := x.GreaterThanOrEqualTo(CM(100))
+	c1.Priority = PriorityWeak
+	c2 := x.LessThanOrEqualTo(CM(50))
+	c2.Priority = PriorityMedium
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2)
+	s.FlushUpdates()
+	expect(t, x, 50)
+
+	if err := s.SetConstraintPriority(c1, PriorityStrong); err != nil {
+		t.Error(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, 100)
+
+	if err := s.SetConstraintPriority(c2, PriorityRequired); err != nil {
+		t.Error(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, 50)
+
+	if err := s.SetConstraintPriority(c1, PriorityRequired); err == nil {
+		t.Error("Conflicting required constraints should not be satisfiable")
+	}
+	if c1.Priority != PriorityStrong {
+		t.Error("Priority should have been restored after failure")
+	}
+
+	if err := s.SetConstraintPriority(c2, PriorityWeak); err != nil {
+		t.Error(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, 100)
+}
+
+func TestUpdateConstraintConstant(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+
+	minWidth := right.Sub(left).GreaterThanOrEqualTo(CM(100))
+	c2 := left.Equals(CM(10))
+	c3 := right.Equals(left)
+	c3.Priority = PriorityWeak
+
+	s := NewSolver()
+	s.AddConstraints(minWidth, c2, c3)
+	s.FlushUpdates()
+	expect(t, right, 110)
+
+	if err := s.UpdateConstraintConstant(minWidth, -150); err != nil {
+		t.Error(err)
+	}
+	s.FlushUpdates()
+	expect(t, right, 160)
+
+	if err := s.UpdateConstraintConstant(c2, -20); err != nil {
+		t.Error(err)
+	}
+	s.FlushUpdates()
+	expect(t, left, 20)
+	expect(t, right, 170)
+
+	c4 := right.LessThanOrEqualTo(CM(200))
+	s.AddConstraint(c4)
+
+	if err := s.UpdateConstraintConstant(minWidth, -250); err == nil {
+		t.Error("Update should not be satisfiable")
+	}
+	if minWidth.expression.constant != -150 {
+		t.Error("Constraint constant should not have changed")
+	}
+	s.FlushUpdates()
+	expect(t, right, 170)
+}
+
+func TestHierarchicalSolver(t *testing.T) {
+	x := NewParam(0)
+
+	stronger := x.Equals(CM(0))
+	stronger.Priority = 2
+
+	weighted := NewSolver()
+	hierarchical := NewHierarchicalSolver()
+
+	for _, s := range []*Solver{weighted, hierarchical} {
+		s.AddConstraint(stronger)
+		for i := 0; i < 3; i++ {
+			weaker := x.GreaterThanOrEqualTo(CM(10))
+			weaker.Priority = 1
+			s.AddConstraint(weaker)
+		}
+	}
+
+	weighted.FlushUpdates()
+	expect(t, x, 10)
+
+	hierarchical.FlushUpdates()
+	expect(t, x, 0)
+}
+
+func TestHierarchicalSolverEditVariables(t *testing.T) {
+	left := NewParam(0)
+	width := NewParam(0)
+	right := NewParam(0)
+
+	s := NewHierarchicalSolver()
+	s.AddConstraint(right.Equals(left.Add(width)))
+
+	c1 := width.GreaterThanOrEqualTo(CM(100))
+	c1.Priority = PriorityStrong
+	c2 := width.Equals(CM(50))
+	c2.Priority = PriorityWeak
+	s.AddConstraints(c1, c2)
+
+	s.AddEditVariable(left.Variable, float64(PriorityMedium))
+	s.SuggestValueForVariable(left.Variable, 20)
+	s.FlushUpdates()
+
+	expect(t, left, 20)
+	expect(t, width, 100)
+	expect(t, right, 120)
+
+	s.SetConstraintPriority(c2, PriorityRequired)
+	s.FlushUpdates()
+	expect(t, width, 50)
+	expect(t, right, 70)
+}
+
+func TestNewPriority(t *testing.T) {
+	if p := NewPriority(1, 0, 0, 1); p != PriorityStrong {
+		t.Error("Priority does not match expected one", PriorityStrong, ", was", p)
+	}
+	if p := NewPriority(1, 0, 10, 1); p != PriorityStrong+10 {
+		t.Error("Priority does not match expected one", PriorityStrong+10, ", was", p)
+	}
+	if p := NewPriority(0, 2, 0, 1.5); p != 3*PriorityMedium {
+		t.Error("Priority does not match expected one", 3*PriorityMedium, ", was", p)
+	}
+	if p := NewPriority(5000, 5000, 5000, 1); p >= PriorityRequired {
+		t.Error("Composite priority should be weaker than required, was", p)
+	}
+}
+
+func TestPriorityText(t *testing.T) {
+	for _, p := range []Priority{PriorityRequired, PriorityStrong, PriorityMedium, PriorityWeak, 0,
+		PriorityStrong + 10, 3 * PriorityMedium, 998, NewPriority(2, 5, 7, 1)} {
+		parsed, err := ParsePriority(p.String())
+		if err != nil {
+			t.Error(err)
+		}
+		if parsed != p {
+			t.Error("Parsed priority does not match expected one", p, ", was", parsed)
+		}
+	}
+
+	expected := map[string]Priority{
+		"strong":    PriorityStrong,
+		" Medium ":  PriorityMedium,
+		"medium:3":  3 * PriorityMedium,
+		"strong+10": PriorityStrong + 10,
+		"medium-2":  PriorityMedium - 2,
+		"weak:0.5":  1,
+		"42":        42,
+	}
+	for text, p := range expected {
+		parsed, err := ParsePriority(text)
+		if err != nil {
+			t.Error(err)
+		}
+		if parsed != p {
+			t.Error("Parsed priority of", text, "does not match expected one", p, ", was", parsed)
+		}
+	}
+
+	for _, text := range []string{"", "strongest", "medium:x", "weak-5", "-5"} {
+		if _, err := ParsePriority(text); err == nil {
+			t.Error("Parsing", text, "should have failed")
+		}
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	x := NewParam(0)
+	y := NewParam(0)
+
+	c1 := x.GreaterThanOrEqualTo(CM(10))
+	c2 := y.Equals(x.Add(CM(5)))
+	c2.Priority = PriorityMedium
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2)
+	s.AddEditVariable(x.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(x.Variable, 20)
+	s.FlushUpdates()
+	expect(t, y, 25)
+
+	tx := s.Begin()
+	s.SuggestValueForVariable(x.Variable, 40)
+	s.RemoveConstraint(c2)
+	s.AddConstraint(y.Equals(CM(100)))
+	s.SetConstraintPriority(c1, PriorityWeak)
+	s.FlushUpdates()
+	expect(t, y, 100)
+
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+	if c1.Priority != PriorityRequired {
+		t.Error("Priority should have been restored")
+	}
+
+	s.FlushUpdates()
+	expect(t, x, 20)
+	expect(t, y, 25)
+
+	s.SuggestValueForVariable(x.Variable, 30)
+	s.FlushUpdates()
+	expect(t, y, 35)
+
+	if err := tx.Commit(); err == nil {
+		t.Error("Finished transaction should not be committed")
+	}
+}
+
+func TestTransactionRollbackEdits(t *testing.T) {
+	x := NewParam(0)
+	y := NewParam(0)
+
+	c1 := x.LessThanOrEqualTo(y)
+	c2 := y.LessThanOrEqualTo(CM(100))
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2)
+	s.AddEditVariable(x.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(x.Variable, 50)
+	s.AddStay(y.Variable, PriorityWeak)
+	s.FlushUpdates()
+	expect(t, x, 50)
+	expect(t, y, 50)
+
+	tx := s.Begin()
+	s.RemoveStay(y.Variable)
+	inner := s.Begin()
+	if err := s.RemoveVariable(x.Variable); err != nil {
+		t.Fatal(err)
+	}
+	inner.Commit()
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.EditVariableCount() != 1 || len(s.Stays()) != 1 {
+		t.Error("Edit variable and stay should have been restored")
+	}
+	if constraints := s.Constraints(); len(constraints) != 2 || constraints[0] != c1 || constraints[1] != c2 {
+		t.Error("Constraints should have been restored in their original order")
+	}
+	if variables := s.Variables(); len(variables) != 2 || variables[0] != x.Variable || variables[1] != y.Variable {
+		t.Error("Variables should have been restored in their original order")
+	}
+	if edits := s.EditVariables(); edits[0].Value != 50 {
+		t.Error("Suggested value should have been restored, was", edits[0].Value)
+	}
+	if s.undo != nil || len(s.scopes) != 0 {
+		t.Error("Undo log should be dropped once all transactions are finished")
+	}
+
+	s.SuggestValueForVariable(x.Variable, 70)
+	s.FlushUpdates()
+	expect(t, x, 70)
+	expect(t, y, 70)
+}
+
+func TestRollbackKeepsOptimalSolution(t *testing.T) {
+	x := NewParam(0)
+	y := NewParam(0)
+	z := NewParam(0)
+
+	sum := x.Add(y).Add(z).Equals(CM(5.5))
+
+	s := NewSolver()
+	s.AddConstraints(x.GreaterThanOrEqualTo(CM(0)), y.GreaterThanOrEqualTo(CM(0)), z.GreaterThanOrEqualTo(CM(0)), sum)
+
+	// every split of the sum is optimal, so only the exact tableau keeps the values
+	values := func() []float64 {
+		return []float64{s.ValueOf(x.Variable), s.ValueOf(y.Variable), s.ValueOf(z.Variable)}
+	}
+	initial := values()
+
+	tx := s.Begin()
+	s.RemoveConstraint(sum)
+	s.AddConstraint(z.LessThanOrEqualTo(CM(1)))
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if current := values(); !reflect.DeepEqual(current, initial) {
+		t.Error("Rollback should restore the values", initial, "got", current)
+	}
+
+	if err := s.RemoveConstraints(sum, z.LessThanOrEqualTo(CM(1))); err == nil {
+		t.Error("Unknown constraint should not be removed")
+	}
+	if current := values(); !reflect.DeepEqual(current, initial) {
+		t.Error("Failed removal should restore the values", initial, "got", current)
+	}
+
+	if err := s.AddConstraints(z.LessThanOrEqualTo(CM(1)), x.LessThanOrEqualTo(CM(-1))); err == nil {
+		t.Error("Constraints should not be satisfiable")
+	}
+	if current := values(); !reflect.DeepEqual(current, initial) {
+		t.Error("Failed addition should restore the values", initial, "got", current)
+	}
+}
+
+func TestRollbackOfRestore(t *testing.T) {
+	x := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraint(x.GreaterThanOrEqualTo(CM(0)))
+	s.AddEditVariable(x.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(x.Variable, 10)
+
+	snapshot := s.Snapshot()
+	tx := s.Begin()
+	s.SuggestValueForVariable(x.Variable, 50)
+	s.Restore(snapshot)
+	s.SuggestValueForVariable(x.Variable, 70)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.FlushUpdates()
+	expect(t, x, 10)
+	if edits := s.EditVariables(); edits[0].Value != 10 {
+		t.Error("Suggested value should have been restored, was", edits[0].Value)
+	}
+
+	s.SuggestValueForVariable(x.Variable, 30)
+	s.FlushUpdates()
+	expect(t, x, 30)
+}
+
+func TestUnsatisfiableConstraintLeavesTableau(t *testing.T) {
+	x := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraint(x.GreaterThanOrEqualTo(CM(10)))
+	rows := len(s.rows)
+
+	if err := s.AddConstraint(x.LessThanOrEqualTo(CM(5))); err == nil {
+		t.Error("Conflicting constraint should not be satisfiable")
+	}
+	if len(s.rows) != rows || s.ConstraintCount() != 1 {
+		t.Error("Unsatisfiable constraint should not be left in the tableau")
+	}
+
+	s.AddConstraint(x.LessThanOrEqualTo(CM(20)))
+	s.FlushUpdates()
+	expect(t, x, 10)
+}
+
+func TestAddConstraintsIsAtomic(t *testing.T) {
+	x := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraint(x.LessThanOrEqualTo(CM(10)))
+
+	c1 := x.GreaterThanOrEqualTo(CM(5))
+	c2 := x.GreaterThanOrEqualTo(CM(20))
+	if err := s.AddConstraints(c1, c2); err == nil {
+		t.Error("Constraints should not be satisfiable")
+	}
+
+	if err := s.AddConstraint(c1); err != nil {
+		t.Error("Constraint should have been rolled back, got", err)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	x := NewParam(0)
+	y := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraint(y.Equals(x.Mult(CM(2))))
+	s.AddEditVariable(x.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(x.Variable, 10)
+
+	initial := s.Snapshot()
+
+	s.SuggestValueForVariable(x.Variable, 20)
+	c := y.LessThanOrEqualTo(CM(30))
+	s.AddConstraint(c)
+	s.FlushUpdates()
+	expect(t, y, 30)
+
+	modified := s.Snapshot()
+
+	for i := 0; i < 2; i++ {
+		if err := s.Restore(initial); err != nil {
+			t.Error(err)
+		}
+		s.FlushUpdates()
+		expect(t, x, 10)
+		expect(t, y, 20)
+
+		s.SuggestValueForVariable(x.Variable, 50)
+		s.FlushUpdates()
+		expect(t, y, 100)
+
+		if err := s.Restore(modified); err != nil {
+			t.Error(err)
+		}
+		s.FlushUpdates()
+		expect(t, x, 15)
+		expect(t, y, 30)
+	}
+
+	if err := NewSolver().Restore(initial); err == nil {
+		t.Error("Snapshot of another solver should not be restored")
+	}
+}
+
+func TestClone(t *testing.T) {
+	width := NewParam(0)
+	left := NewParam(0)
+	right := NewParam(0)
+
+	c1 := left.Equals(CM(10))
+	c2 := right.Equals(width.Sub(CM(10)))
+	c3 := right.Sub(left).GreaterThanOrEqualTo(CM(100))
+	c3.Priority = PriorityMedium
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2, c3)
+	s.AddEditVariable(width.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(width.Variable, 300)
+
+	clonedWidth := NewVariable(0)
+	clonedRight := NewVariable(0)
+	clone, constraints := s.Clone(map[*Variable]*Variable{
+		width.Variable: clonedWidth,
+		right.Variable: clonedRight,
+	})
+	if len(constraints) != 3 {
+		t.Error("Constraint count does not match expected one", 3, ", was", len(constraints))
+	}
+
+	clone.SuggestValueForVariable(clonedWidth, 50)
+	clone.FlushUpdates()
+	s.FlushUpdates()
+
+	expect(t, width, 300)
+	expect(t, right, 290)
+	if clonedWidth.Value != 50 || clonedRight.Value != 40 {
+		t.Error("Cloned values do not match expected ones", 50, 40, ", were", clonedWidth.Value, clonedRight.Value)
+	}
+
+	if err := clone.RemoveConstraint(constraints[c3]); err != nil {
+		t.Error(err)
+	}
+	if err := clone.RemoveConstraint(c3); err == nil {
+		t.Error("Original constraint should not be known to the clone")
+	}
+	if err := s.SetConstraintPriority(c3, PriorityWeak); err != nil {
+		t.Error(err)
+	}
+	if constraints[c3].Priority != PriorityMedium {
+		t.Error("Cloned constraint should not be affected by the original one")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	left := NewParam(0)
+	left.Variable.Name = "left"
+	right := NewParam(0)
+	right.Variable.Name = "right"
+	width := NewParam(0)
+	width.Variable.Name = "width"
+
+	c1 := right.Sub(left).Equals(width)
+	c2 := width.GreaterThanOrEqualTo(CM(100))
+	c2.Priority = NewPriority(1, 0, 10, 1)
+	c3 := left.LessThanOrEqualTo(CM(20))
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2, c3)
+	s.AddEditVariable(left.Variable, float64(PriorityMedium))
+	s.SuggestValueForVariable(left.Variable, 30)
+	s.FlushUpdates()
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, variables, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 3 {
+		t.Fatal("Variable count does not match expected one", 3, ", was", len(variables))
+	}
+
+	loaded.FlushUpdates()
+	for i, original := range []*Variable{right.Variable, left.Variable, width.Variable} {
+		if variables[i].Name != original.Name {
+			t.Error("Variable name does not match expected one", original.Name, ", was", variables[i].Name)
+		}
+		if variables[i].Value != original.Value {
+			t.Error("Value of", original.Name, "does not match expected one", original.Value, ", was", variables[i].Value)
+		}
+	}
+
+	again, err := Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Error("Marshaled systems differ", string(data), string(again))
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"version": 0}`,
+		`{"version": 99}`,
+		`{"version": 1, "constraints": [{"terms": [{"variable": 3, "coefficient": 1}], "relation": "==", "priority": "weak"}]}`,
+		`{"version": 1, "variables": [{"id": 0}], "constraints": [{"terms": [{"variable": 0, "coefficient": 1}], "relation": "=<", "priority": "weak"}]}`,
+		`{"version": 1, "variables": [{"id": 0}], "constraints": [{"terms": [{"variable": 0, "coefficient": 1}], "relation": "==", "priority": "strongest"}]}`,
+	} {
+		if _, _, err := Unmarshal([]byte(data)); err == nil {
+			t.Error("Unmarshaling", data, "should have failed")
+		}
+	}
+}
+
+func TestUnmarshalOlderVersion(t *testing.T) {
+	data := `{"version": 1, "variables": [{"id": 0, "name": "left"}, {"id": 1, "name": "right"}],
+		"constraints": [{"terms": [{"variable": 1, "coefficient": 1}, {"variable": 0, "coefficient": -1}],
+			"constant": -100, "relation": ">=", "priority": "required"}],
+		"edits": [{"variable": 0, "priority": "strong", "value": 50}]}`
+
+	s, variables, err := Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	if variables[0].Value != 50 || variables[1].Value != 150 {
+		t.Error("Values do not match expected ones", 50, 150, ", were", variables[0].Value, variables[1].Value)
+	}
+}
+
+func TestTableauRoundTrip(t *testing.T) {
+	left := NewParam(0)
+	left.Variable.Name = "left"
+	right := NewParam(0)
+	right.Variable.Name = "right"
+	mid := NewParam(0)
+	mid.Variable.Name = "mid"
+
+	c1 := right.Add(left).Equals(mid.Mult(CM(2)))
+	c2 := right.Sub(left).GreaterThanOrEqualTo(CM(100))
+	c3 := right.Sub(left).Equals(CM(100))
+	c4 := right.LessThanOrEqualTo(CM(500))
+	c4.Priority = PriorityStrong
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2, c3, c4)
+	s.AddEditVariable(left.Variable, float64(PriorityMedium))
+	s.SuggestValueForVariable(left.Variable, 450)
+
+	data, err := EncodeTableau(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedLeft := NewParam(0)
+	decodedLeft.Variable.Name = "left"
+	decodedRight := NewParam(0)
+	decodedRight.Variable.Name = "right"
+	decoded, variables, constraints, err := DecodeTableau(data, map[string]*Variable{
+		"left":  decodedLeft.Variable,
+		"right": decodedRight.Variable,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 3 || variables[0] != decodedRight.Variable || variables[1] != decodedLeft.Variable ||
+		variables[2].Name != "mid" {
+		t.Error("Decoded variables do not match", variables)
+	}
+	if len(constraints) != 4 || constraints[3].Priority != PriorityStrong {
+		t.Fatal("Decoded constraints do not match", constraints)
+	}
+
+	again, err := EncodeTableau(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Error("Encoded tableaus differ")
+	}
+
+	s.FlushUpdates()
+	decoded.FlushUpdates()
+	expect(t, decodedLeft, left.Value())
+	expect(t, decodedRight, right.Value())
+
+	s.SuggestValueForVariable(left.Variable, 50)
+	decoded.SuggestValueForVariable(decodedLeft.Variable, 50)
+	s.FlushUpdates()
+	decoded.FlushUpdates()
+	expect(t, decodedLeft, 50)
+	expect(t, decodedRight, right.Value())
+
+	if err := decoded.RemoveConstraint(constraints[3]); err != nil {
+		t.Error("Decoded constraints should be removable", err)
+	}
+	decoded.FlushUpdates()
+	expect(t, decodedRight, 150)
+
+	if _, _, _, err := DecodeTableau(data[:len(data)-3], nil); err == nil {
+		t.Error("Truncated tableau should not be decoded")
+	}
+
+	hierarchical := NewHierarchicalSolver()
+	soft := left.LessThanOrEqualTo(CM(10))
+	soft.Priority = PriorityStrong
+	hierarchical.AddConstraint(soft)
+	data, err = EncodeTableau(hierarchical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// clear the hierarchical flag, so the objective levels do not fit the solver anymore
+	data[5] = 0
+	if _, _, _, err := DecodeTableau(data, nil); err == nil {
+		t.Error("Corrupted tableau should not be decoded")
+	}
+
+	duplicate := NewParam(0)
+	duplicate.Variable.Name = "left"
+	s.AddConstraint(duplicate.Equals(left))
+	if _, err := EncodeTableau(s); err == nil {
+		t.Error("Duplicate variable names should not be encoded")
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	left := NewParam(0)
+	left.Variable.Name = "left"
+	right := NewParam(0)
+	right.Variable.Name = "right"
+	width := NewParam(0)
+	width.Variable.Name = "width"
+
+	s := NewSolver()
+	s.AddConstraint(right.Sub(left).Equals(width))
+
+	log := &bytes.Buffer{}
+	recorder := NewRecorder(log)
+	s.SetRecorder(recorder)
+
+	minWidth := width.GreaterThanOrEqualTo(CM(100))
+	minWidth.Priority = PriorityStrong
+	s.AddConstraints(minWidth, left.GreaterThanOrEqualTo(CM(0)))
+	s.AddEditVariable(left.Variable, float64(PriorityStrong))
+	s.AddEditVariable(right.Variable, float64(PriorityWeak))
+	s.SuggestValueForVariable(left.Variable, 10)
+	s.SuggestValueForVariable(right.Variable, 50)
+	s.FlushUpdates()
+
+	tx := s.Begin()
+	s.UpdateConstraintConstant(minWidth, -20)
+	s.FlushUpdates()
+	tx.Rollback()
+
+	s.AddConstraint(width.LessThanOrEqualTo(CM(-10)))
+	s.AddConstraint(left.LessThanOrEqualTo(CM(-5)))
+	s.SetConstraintPriority(minWidth, PriorityMedium)
+	s.RemoveConstraint(minWidth)
+	s.FlushUpdates()
+
+	if recorder.Err() != nil {
+		t.Fatal(recorder.Err())
+	}
+
+	recorded := log.String()
+	result, err := Replay(strings.NewReader(recorded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Differences) != 0 {
+		t.Error("Replay should not differ from recording, got", len(result.Differences), "differences")
+	}
+	if len(result.Variables) != 3 || result.Variables[0].Name != "right" {
+		t.Error("Replayed variables do not match recorded ones")
+	}
+
+	tampered := strings.Replace(recorded, `{"variable":2,"value":100}]`, `{"variable":2,"value":101}]`, 1)
+	result, err = Replay(strings.NewReader(tampered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Differences) != 1 || result.Differences[0].Op != "flush" {
+		t.Error("Replay of tampered log should report a single difference, got", len(result.Differences))
+	}
+}
+
+func TestEnumeration(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+
+	c1 := right.Sub(left).Equals(width)
+	c2 := width.GreaterThanOrEqualTo(CM(100))
+	c3 := left.GreaterThanOrEqualTo(CM(0))
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2, c3)
+	s.AddEditVariable(width.Variable, float64(PriorityStrong))
+	s.AddEditVariable(left.Variable, float64(PriorityMedium))
+	s.SuggestValueForVariable(width.Variable, 200)
+	s.RemoveConstraint(c2)
+	s.AddConstraint(c2)
+
+	constraints := s.Constraints()
+	if s.ConstraintCount() != 3 || len(constraints) != 3 {
+		t.Fatal("Constraint count does not match expected one", 3, ", was", len(constraints))
+	}
+	if constraints[0] != c1 || constraints[1] != c3 || constraints[2] != c2 {
+		t.Error("Constraints are not in insertion order")
+	}
+
+	variables := s.Variables()
+	if s.VariableCount() != 3 || len(variables) != 3 {
+		t.Fatal("Variable count does not match expected one", 3, ", was", len(variables))
+	}
+	if variables[0] != right.Variable || variables[1] != left.Variable || variables[2] != width.Variable {
+		t.Error("Variables are not in order of first use")
+	}
+
+	edits := s.EditVariables()
+	if s.EditVariableCount() != 2 || len(edits) != 2 {
+		t.Fatal("Edit variable count does not match expected one", 2, ", was", len(edits))
+	}
+	if edits[0].Variable != width.Variable || edits[0].Priority != PriorityStrong || edits[0].Value != 200 {
+		t.Error("First edit variable does not match expected one")
+	}
+	if edits[1].Variable != left.Variable || edits[1].Priority != PriorityMedium || edits[1].Value != 0 {
+		t.Error("Second edit variable does not match expected one")
+	}
+}
+
+func TestVariableReferences(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	mid := NewParam(0)
+
+	c1 := left.GreaterThanOrEqualTo(CM(10))
+	c2 := right.Sub(left).GreaterThanOrEqualTo(CM(100))
+	c3 := mid.Equals(left.Add(right).Div(CM(2)))
+
+	s := NewSolver()
+	s.AddConstraints(c1, c2, c3)
+	s.AddEditVariable(right.Variable, float64(PriorityStrong))
+
+	if s.VariableCount() != 3 {
+		t.Error("Variable count does not match expected one", 3, ", was", s.VariableCount())
+	}
+
+	s.RemoveConstraint(c3)
+	if s.VariableCount() != 2 {
+		t.Error("Variable of removed constraint should have been dropped")
+	}
+	for _, update := range s.FlushUpdates() {
+		if update.Context == mid {
+			t.Error("Dropped variable should not be updated")
+		}
+	}
+
+	if err := s.RemoveVariable(mid.Variable); err == nil {
+		t.Error("Removing an unknown variable should fail")
+	}
+
+	if err := s.RemoveVariable(left.Variable); err != nil {
+		t.Fatal(err)
+	}
+	if s.ConstraintCount() != 0 {
+		t.Error("Constraints mentioning the variable should have been removed, left", s.ConstraintCount())
+	}
+	if s.VariableCount() != 1 || s.EditVariableCount() != 1 {
+		t.Error("Only the edit variable should be left")
+	}
+
+	if err := s.RemoveVariable(right.Variable); err != nil {
+		t.Fatal(err)
+	}
+	if s.VariableCount() != 0 || s.EditVariableCount() != 0 || len(s.rows) != 0 {
+		t.Error("Solver should be empty after removing all variables")
+	}
+
+	if err := s.AddConstraint(c3); err != nil {
+		t.Fatal(err)
+	}
+	s.AddEditVariable(left.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(left.Variable, 20)
+	s.FlushUpdates()
+	if s.VariableCount() != 3 {
+		t.Error("Variable count does not match expected one", 3, ", was", s.VariableCount())
+	}
+}
+
+func TestSyncSolver(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+
+	s := NewSyncSolver(nil)
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(0)),
+		right.Sub(left).GreaterThanOrEqualTo(CM(100)),
+	)
+	s.AddEditVariable(left.Variable, float64(PriorityStrong))
+	s.AddEditVariable(right.Variable, float64(PriorityStrong))
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 2; writer++ {
+		wg.Add(1)
+		go func(offset float64) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				s.SuggestValueForVariable(left.Variable, float64(i)+offset)
+				s.SuggestValueForVariable(right.Variable, float64(2*i)+offset)
+				s.FlushUpdates()
+			}
+		}(float64(writer))
+	}
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				values := s.Values(left.Variable, right.Variable)
+				if values[1]-values[0] < 100-1e-6 {
+					t.Error("Inconsistent values read", values)
+					return
+				}
+				s.ValueOf(left.Variable)
+				s.Constraints()
+				if min, _, _ := s.Bounds(left.Variable); min != 0 {
+					t.Error("Bounds of left do not match expected ones", 0, ", were", min)
+					return
+				}
+				if _, err := s.Sensitivity(s.Constraints()[0]); err != nil {
+					t.Error(err)
+					return
+				}
+				if value, levels := s.ObjectiveValue(), s.ObjectiveLevels(); value < 0 || len(levels) == 0 {
+					t.Error("Objective should have been available, was", value, levels)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.SuggestValueForVariable(left.Variable, 50)
+	s.SuggestValueForVariable(right.Variable, 300)
+	values := s.Values(left.Variable, right.Variable)
+	if values[0] != 50 || values[1] != 300 {
+		t.Error("Values did not match expected ones", 50, 300, ", were", values)
+	}
+	s.FlushUpdates()
+	expect(t, left, 50)
+	expect(t, right, 300)
+
+	tx := s.Begin()
+	s.AddConstraint(right.LessThanOrEqualTo(CM(200)))
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+	if len(s.Constraints()) != 2 {
+		t.Error("Rollback should have removed the constraint")
+	}
+
+	objective, err := s.Minimize(right.Sub(left), PriorityWeak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Objectives()) != 1 {
+		t.Error("Objective should have been added")
+	}
+	if err := s.RemoveObjective(objective); err != nil {
+		t.Error(err)
+	}
+
+	s.RemoveEditVariable(left.Variable)
+	session, err := s.BeginEdit(map[*Variable]Priority{left.Variable: PriorityStrong})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.Values(left.Variable, right.Variable)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		session.Suggest(left.Variable, float64(i))
+		session.Resolve()
+	}
+	<-done
+	if _, err := session.End(); err != nil {
+		t.Error(err)
+	}
+	if len(s.EditVariables()) != 1 {
+		t.Error("Ending the session should have removed its edit variable")
+	}
+}
+
+func TestService(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+
+	var log bytes.Buffer
+	solver := NewSolver()
+	solver.SetRecorder(NewRecorder(&log))
+
+	service := NewService(solver, 16)
+	commands := service.Commands()
+
+	// the result of the first command is received only after all commands were sent, so the Service
+	// is blocked within the first batch until everything is queued up and applies it in a single batch
+	added := make(chan error)
+	suggested := make(chan error, 1)
+	commands <- NewAddCommand(
+		left.GreaterThanOrEqualTo(CM(0)),
+		right.Sub(left).GreaterThanOrEqualTo(CM(100)),
+	).WithResult(added)
+	commands <- NewEditCommand(left.Variable, float64(PriorityStrong))
+	for i := 1; i <= 10; i++ {
+		commands <- NewSuggestCommand(left.Variable, float64(i*10))
+	}
+	commands <- NewSuggestCommand(right.Variable, 0).WithResult(suggested)
+	service.Close()
+
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+
+	batches := 0
+	for range service.Updates() {
+		batches++
+	}
+
+	if err := <-suggested; err == nil {
+		t.Error("Suggesting a value for a variable without edit should fail")
+	}
+	if batches != 1 {
+		t.Error("Commands should have been applied in", 1, "batch, were", batches)
+	}
+	if count := strings.Count(log.String(), `"op":"suggest"`); count != 1 {
+		t.Error("Suggestions should have been coalesced, applied", count)
+	}
+	expect(t, left, 100)
+	expect(t, right, 200)
+}
+
+func TestPartitionedSolver(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		panels := make([][2]*Param, 4)
+		constraints := make([]*Constraint, 0)
+		for i := range panels {
+			left, right := NewParam(0), NewParam(0)
+			panels[i] = [2]*Param{left, right}
+			constraints = append(constraints,
+				left.GreaterThanOrEqualTo(CM(float64(i*10))),
+				right.Sub(left).GreaterThanOrEqualTo(CM(100)),
+			)
+		}
+
+		p := NewPartitionedSolver()
+		p.Parallel = parallel
+		if err := p.AddConstraints(constraints...); err != nil {
+			t.Fatal(err)
+		}
+		if p.ComponentCount() != 4 {
+			t.Error("Component count does not match expected one", 4, ", was", p.ComponentCount())
+		}
+
+		p.AddEditVariable(panels[0][1].Variable, float64(PriorityStrong))
+		p.SuggestValueForVariable(panels[0][1].Variable, 150)
+
+		// a failing constraint linking two panels leaves both untouched
+		err := p.AddConstraints(
+			panels[1][0].Equals(panels[0][1]),
+			panels[2][0].LessThanOrEqualTo(CM(-1)),
+		)
+		if err == nil {
+			t.Error("Unsatisfiable constraint should have been rejected")
+		}
+		if p.ComponentCount() != 4 {
+			t.Error("Components should not have been merged by a failed operation")
+		}
+
+		link := panels[1][0].Equals(panels[0][1])
+		if err := p.AddConstraint(link); err != nil {
+			t.Fatal(err)
+		}
+		if p.ComponentCount() != 3 {
+			t.Error("Component count does not match expected one", 3, ", was", p.ComponentCount())
+		}
+
+		p.FlushUpdates()
+		expect(t, panels[0][1], 150)
+		expect(t, panels[1][0], 150)
+		expect(t, panels[1][1], 250)
+		expect(t, panels[3][0], 30)
+		expect(t, panels[3][1], 130)
+
+		p.SuggestValueForVariable(panels[0][1].Variable, 200)
+		p.FlushUpdates()
+		expect(t, panels[1][1], 300)
+
+		if err := p.RemoveConstraints(constraints[6], constraints[7]); err != nil {
+			t.Fatal(err)
+		}
+		if p.ComponentCount() != 2 {
+			t.Error("Empty component should have been dropped")
+		}
+	}
+}
+
+func TestChildSolver(t *testing.T) {
+	containerWidth := NewParam(0)
+	childWidth := NewParam(0)
+	childHeight := NewParam(0)
+	total := NewParam(0)
+
+	parent := NewSolver()
+	parent.AddConstraints(
+		childWidth.Equals(containerWidth.Sub(CM(20))),
+		total.Equals(childHeight.Add(CM(50))),
+	)
+	parent.AddEditVariable(containerWidth.Variable, float64(PriorityStrong))
+	parent.SuggestValueForVariable(containerWidth.Variable, 200)
+
+	width := NewParam(0)
+	left := NewParam(0)
+	right := NewParam(0)
+	height := NewParam(0)
+
+	child := NewChild(parent)
+	child.AddConstraints(
+		left.Add(right).Equals(width),
+		left.Equals(right),
+		height.Equals(left.Mult(CM(0.5)).Add(CM(10))),
+	)
+	if err := child.BindInput(childWidth.Variable, width.Variable, PriorityStrong); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.BindOutput(height.Variable, childHeight.Variable, PriorityStrong); err != nil {
+		t.Fatal(err)
+	}
+
+	if updates := child.Update(); updates == nil {
+		t.Error("First update should solve the child")
+	}
+	parent.FlushUpdates()
+	expect(t, left, 90)
+	expect(t, height, 55)
+	expect(t, total, 105)
+
+	if updates := child.Update(); updates != nil {
+		t.Error("Child should not be solved again without changed inputs")
+	}
+
+	parent.SuggestValueForVariable(containerWidth.Variable, 400)
+	child.Update()
+	parent.FlushUpdates()
+	expect(t, right, 190)
+	expect(t, total, 155)
+}
+
+func TestObjective(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(0)),
+		right.LessThanOrEqualTo(CM(500)),
+		width.Equals(right.Sub(left)),
+		width.LessThanOrEqualTo(CM(300)),
+	)
+
+	widest, err := s.Maximize(width.asExpression(), PriorityWeak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	expect(t, width, 300)
+
+	limit := width.LessThanOrEqualTo(CM(250))
+	limit.Priority = PriorityStrong
+	s.AddConstraint(limit)
+	s.FlushUpdates()
+	expect(t, width, 250)
+
+	// variables are unrestricted, so left has to decrease until the constraints stop it
+	leftmost, err := s.Minimize(left.asExpression(), PriorityMedium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	expect(t, left, 0)
+	expect(t, right, 250)
+
+	if _, err := s.Minimize(left.asExpression(), PriorityRequired); err == nil {
+		t.Error("Required objectives should be rejected")
+	}
+
+	if len(s.Objectives()) != 2 {
+		t.Error("Objective count does not match expected one", 2, ", was", len(s.Objectives()))
+	}
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, variables, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.FlushUpdates()
+	if len(loaded.Objectives()) != 2 {
+		t.Error("Objectives were not restored")
+	}
+	for _, v := range variables {
+		if v.Value != loaded.ValueOf(v) {
+			t.Error("Unmarshaled solver does not match original one")
+		}
+	}
+
+	encoded, err := EncodeTableau(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, _, err := DecodeTableau(encoded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Objectives()) != 2 {
+		t.Error("Objectives were not decoded")
+	}
+
+	if err := s.RemoveObjective(leftmost); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveObjective(leftmost); err == nil {
+		t.Error("Removing an objective twice should fail")
+	}
+	s.RemoveObjective(widest)
+	if len(s.Objectives()) != 0 {
+		t.Error("All objectives should have been removed")
+	}
+}
+
+func TestUnboundedObjective(t *testing.T) {
+	x := NewParam(0)
+	y := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraints(
+		x.GreaterThanOrEqualTo(CM(-50)),
+		y.Equals(x.Add(CM(10))),
+	)
+
+	if _, err := s.Maximize(y.asExpression(), PriorityStrong); err == nil {
+		t.Error("Unbounded objective should have been rejected")
+	}
+	if len(s.Objectives()) != 0 {
+		t.Error("Rejected objective should not have been added")
+	}
+
+	if _, err := s.Minimize(y.asExpression(), PriorityStrong); err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, -50)
+	expect(t, y, -40)
+}
+
+func TestObjectiveBoundingConstraint(t *testing.T) {
+	x := NewParam(0)
+
+	s := NewSolver()
+	limit := x.LessThanOrEqualTo(CM(100))
+	s.AddConstraint(limit)
+	preferred := x.LessThanOrEqualTo(CM(50))
+	preferred.Priority = PriorityStrong
+	s.AddConstraint(preferred)
+
+	if _, err := s.Maximize(x.asExpression(), PriorityMedium); err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, 50)
+
+	if err := s.SetConstraintPriority(preferred, PriorityWeak); err != nil {
+		t.Fatal(err)
+	}
+	s.FlushUpdates()
+	expect(t, x, 100)
+
+	// the objective would become unbounded, so the constraint has to stay
+	if err := s.RemoveConstraint(limit); err == nil {
+		t.Error("Removing the bounding constraint should have been rejected")
+	}
+	if s.ConstraintCount() != 2 {
+		t.Error("Rejected removal should have left the constraint, count", s.ConstraintCount())
+	}
+	s.FlushUpdates()
+	expect(t, x, 100)
+
+	if err := s.SetConstraintPriority(limit, PriorityStrong); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetConstraintPriority(limit, PriorityWeak); err == nil {
+		t.Error("Weakening the bounding constraint below the objective should have been rejected")
+	}
+	if limit.Priority != PriorityStrong {
+		t.Error("Rejected priority change should have kept the priority, was", limit.Priority)
+	}
+	s.FlushUpdates()
+	expect(t, x, 100)
+}
+
+func TestObjectiveRuleWithoutObjectives(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(0)),
+		right.Sub(left).GreaterThanOrEqualTo(CM(100)),
+	)
+	s.AddEditVariable(right.Variable, float64(PriorityStrong))
+	s.SuggestValueForVariable(right.Variable, 300)
+
+	// external symbols only enter the basis to decrease while objectives are present
+	external := &internal.Symbol{internal.External}
+	row := internal.NewRow(0.0)
+	row.InsertSymbol(external, 1.0)
+	if entering := s.enteringSymbolForObjectiveRow(row, s.hasObjectiveTerms(s.objective), nil); entering.Type != internal.Invalid {
+		t.Error("External symbols should not decrease without objectives")
+	}
+
+	objective, err := s.Minimize(left.asExpression(), PriorityWeak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entering := s.enteringSymbolForObjectiveRow(row, s.hasObjectiveTerms(s.objective), nil); entering != external {
+		t.Error("External symbols should decrease with objectives")
+	}
+
+	s.RemoveObjective(objective)
+	s.SuggestValueForVariable(right.Variable, 400)
+	s.FlushUpdates()
+	expect(t, left, 0)
+	expect(t, right, 400)
+}
+
+func TestBounds(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+	free := NewParam(0)
+
+	s := NewSolver()
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(10)),
+		right.LessThanOrEqualTo(CM(500)),
+		width.Equals(right.Sub(left)),
+		width.GreaterThanOrEqualTo(CM(100)),
+		free.GreaterThanOrEqualTo(left),
+	)
+	preferred := width.Equals(CM(200))
+	preferred.Priority = PriorityStrong
+	s.AddConstraint(preferred)
+	s.FlushUpdates()
+
+	rows := make(map[*internal.Symbol]internal.Row, len(s.rows))
+	for symbol, row := range s.rows {
+		rows[symbol] = *internal.CopyRow(row)
+	}
+
+	min, max, err := s.Bounds(left.Variable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if min != 10 || max != 400 {
+		t.Error("Bounds of left do not match expected ones", 10, 400, ", were", min, max)
+	}
+
+	min, max, _ = s.Bounds(width.Variable)
+	if min != 100 || max != 490 {
+		t.Error("Bounds of width do not match expected ones", 100, 490, ", were", min, max)
+	}
+
+	min, max, _ = s.Bounds(free.Variable)
+	if min != 10 || !math.IsInf(max, 1) {
+		t.Error("Bounds of free do not match expected ones", 10, math.Inf(1), ", were", min, max)
+	}
+
+	if _, _, err := s.Bounds(NewParam(0).Variable); err == nil {
+		t.Error("Bounds of unknown variable should not be available")
+	}
+
+	if len(rows) != len(s.rows) {
+		t.Error("Bounds should not have changed the tableau")
+	}
+	for symbol, row := range s.rows {
+		if expected, ok := rows[symbol]; !ok || !reflect.DeepEqual(expected, *row) {
+			t.Error("Bounds should not have changed the tableau")
+			break
+		}
+	}
+
+	s.FlushUpdates()
+	expect(t, width, 200)
+}
+
+func TestSensitivity(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+
+	limit := right.LessThanOrEqualTo(CM(250))
+	preferred := width.Equals(CM(300))
+	preferred.Priority = PriorityStrong
+
+	s := NewSolver()
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(0)),
+		width.Equals(right.Sub(left)),
+		width.GreaterThanOrEqualTo(CM(100)),
+		limit,
+		preferred,
+	)
+
+	near := func(a, b float64) bool {
+		return internal.IsNearZero(a - b)
+	}
+
+	sensitivity, err := s.Sensitivity(preferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(sensitivity.ShadowPrice, -float64(PriorityStrong)) || !near(sensitivity.Upper, -250) || !math.IsInf(sensitivity.Lower, -1) {
+		t.Error("Sensitivity of preferred width does not match expected one", *sensitivity)
+	}
+
+	sensitivity, err = s.Sensitivity(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(sensitivity.ShadowPrice, float64(PriorityStrong)) || !near(sensitivity.Lower, -300) || !near(sensitivity.Upper, -100) {
+		t.Error("Sensitivity of limit does not match expected one", *sensitivity)
+	}
+
+	if _, err := NewHierarchicalSolver().Sensitivity(limit); err == nil {
+		t.Error("Sensitivity should not be available for hierarchical solvers")
+	}
+}
+
+func TestObjectiveValue(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	width := NewParam(0)
+
+	preferredWidth := width.Equals(CM(300))
+	preferredWidth.Priority = PriorityStrong
+	preferredLeft := left.Equals(CM(20))
+	preferredLeft.Priority = PriorityWeak
+
+	s := NewSolver()
+	s.AddConstraints(
+		left.GreaterThanOrEqualTo(CM(0)),
+		right.LessThanOrEqualTo(CM(250)),
+		width.Equals(right.Sub(left)),
+		preferredWidth,
+		preferredLeft,
+	)
+	s.Maximize(right.asExpression(), PriorityMedium)
+
+	levels := s.ObjectiveLevels()
+	if len(levels) != 3 {
+		t.Fatal("Level count does not match expected one", 3, ", was", len(levels))
+	}
+	expected := []*ObjectiveLevel{
+		{PriorityStrong, 50, 50 * float64(PriorityStrong)},
+		{PriorityMedium, -250, -250 * float64(PriorityMedium)},
+		{PriorityWeak, 20, 20 * float64(PriorityWeak)},
+	}
+	total := 0.0
+	for i, level := range levels {
+		if level.Priority != expected[i].Priority || !internal.IsNearZero(level.Value-expected[i].Value) ||
+			!internal.IsNearZero(level.Weighted-expected[i].Weighted) {
+			t.Error("Level does not match expected one", *expected[i], ", was", *level)
+		}
+		total += expected[i].Weighted
+	}
+
+	if !internal.IsNearZero(s.ObjectiveValue() - total) {
+		t.Error("Objective value does not match expected one", total, ", was", s.ObjectiveValue())
+	}
+}
+
+func TestQuadraticEdits(t *testing.T) {
+	left := NewParam(0)
+	right := NewParam(0)
+	left.Variable.Name = "left"
+	right.Variable.Name = "right"
+
+	s := NewSolver()
+	if err := s.SetQuadraticEdits(0, 10); err == nil {
+		t.Error("Bad step should have been rejected")
+	}
+	if err := s.SetQuadraticEdits(10, 20); err != nil {
+		t.Fatal(err)
+	}
+	s.AddConstraint(right.Sub(left).Equals(CM(100)))
+	s.AddEditVariable(left.Variable, float64(PriorityStrong))
+	s.AddEditVariable(right.Variable, float64(PriorityStrong))
+
+	// both edits are missed by the same amount instead of one of them winning
+	s.SuggestValueForVariable(left.Variable, 0)
+	s.SuggestValueForVariable(right.Variable, 300)
+	s.FlushUpdates()
+	expect(t, left, 100)
+	expect(t, right, 200)
+
+	if s.ConstraintCount() != 1 {
+		t.Error("Bands of edit variables should not be reported as constraints")
+	}
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, variables, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := make(map[string]*Variable)
+	for _, v := range variables {
+		named[v.Name] = v
+	}
+	loaded.SuggestValueForVariable(named["left"], 40)
+	loaded.FlushUpdates()
+	if named["left"].Value != 120 || named["right"].Value != 220 {
+		t.Error("Unmarshaled edits should still be quadratic, values were", named["left"].Value, named["right"].Value)
+	}
+
+	encoded, err := EncodeTableau(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, _, err := DecodeTableau(encoded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ConstraintCount() != 1 || decoded.EditVariableCount() != 2 {
+		t.Error("Decoded solver does not match original one")
+	}
+
+	if err := s.RemoveVariable(right.Variable); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.constraints) != 1+2*19 {
+		t.Error("Bands should have been removed together with their edit variable, left", len(s.constraints))
+	}
+}
+
+func TestQuadraticEditsRoundTrip(t *testing.T) {
+	for _, linearFirst := range []bool{true, false} {
+		left := NewParam(0)
+		right := NewParam(0)
+		left.Variable.Name = "left"
+		right.Variable.Name = "right"
+
+		s := NewSolver()
+		if !linearFirst {
+			s.SetQuadraticEdits(10, 4)
+		}
+		// the linear edit is stronger than the first two slopes of the quadratic one, so the quadratic
+		// edit is missed by 20 and the solution is unique
+		first, second := 2500.0, float64(PriorityMedium)
+		if !linearFirst {
+			first, second = second, first
+		}
+		s.AddConstraint(right.Sub(left).Equals(CM(100)))
+		s.AddEditVariable(left.Variable, first)
+		if linearFirst {
+			s.SetQuadraticEdits(10, 4)
+		} else {
+			s.SetQuadraticEdits(0, 0)
+		}
+		s.AddEditVariable(right.Variable, second)
+		s.SuggestValueForVariable(left.Variable, 0)
+		s.SuggestValueForVariable(right.Variable, 300)
+
+		data, err := Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, variables, err := Unmarshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		named := make(map[string]*Variable)
+		for _, v := range variables {
+			named[v.Name] = v
+		}
+
+		// every edit keeps the bands it was added with, regardless of the mode of the solver
+		if len(loaded.constraints) != len(s.constraints) {
+			t.Error("Unmarshaled constraint count does not match", len(s.constraints), ", was", len(loaded.constraints))
+		}
+		for _, pair := range [][2]*Variable{{left.Variable, named["left"]}, {right.Variable, named["right"]}} {
+			if len(loaded.edits[pair[1]].bands) != len(s.edits[pair[0]].bands) {
+				t.Error("Bands of", pair[0].Name, "do not match", len(s.edits[pair[0]].bands), ", were",
+					len(loaded.edits[pair[1]].bands))
+			}
+		}
+		if (loaded.quadratic == nil) != (s.quadratic == nil) {
+			t.Error("Quadratic mode of the solver was not restored")
+		}
+
+		again, err := Marshal(loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != string(data) {
+			t.Error("Marshaled systems differ", string(data), string(again))
+		}
+
+		s.FlushUpdates()
+		if linearFirst {
+			expect(t, left, 180)
+			expect(t, right, 280)
+		} else {
+			expect(t, left, 20)
+			expect(t, right, 120)
+		}
+		loaded.FlushUpdates()
+		if named["left"].Value != left.Value() || named["right"].Value != right.Value() {
+			t.Error("Unmarshaled values do not match", left.Value(), right.Value(), ", were", named["left"].Value,
+				named["right"].Value)
+		}
+	}
+}
+
+func TestStays(t *testing.T) {
+	s := NewSolver()
+	left := NewParam(0)
+	left.Variable.Name = "left"
+	right := NewParam(0)
+	right.Variable.Name = "right"
+
+	s.AddConstraint(right.GreaterThanOrEqualTo(left.Add(CM(10))))
+	target := right.Equals(CM(100))
+	target.Priority = PriorityWeak
+	s.AddConstraint(target)
+	s.AddEditVariable(left.Variable, float64(PriorityStrong))
+	if err := s.AddStay(right.Variable, PriorityMedium); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddStay(right.Variable, PriorityMedium); err == nil {
+		t.Error("Duplicate stay should fail")
+	}
+	if err := s.AddStay(left.Variable, PriorityRequired); err == nil {
+		t.Error("Required stay should fail")
+	}
+
+	s.FlushUpdates()
+	expect(t, right, 10)
+
+	// the stay follows the flushed values instead of pulling back to where it was added
+	s.SuggestValueForVariable(left.Variable, 50)
+	s.FlushUpdates()
+	expect(t, right, 60)
+	s.SuggestValueForVariable(left.Variable, 0)
+	s.FlushUpdates()
+	expect(t, right, 60)
+
+	if stays := s.Stays(); len(stays) != 1 || stays[0].Variable != right.Variable || stays[0].Value != 60 {
+		t.Error("Unexpected stays", stays)
+	}
+	if s.ConstraintCount() != 2 {
+		t.Error("Stays should not be reported as constraints")
+	}
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, variables, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stays := loaded.Stays(); len(stays) != 1 || stays[0].Variable.Name != "right" || stays[0].Value != 60 {
+		t.Error("Unmarshaled stays do not match", stays)
+	}
+	loaded.FlushUpdates()
+	for _, v := range variables {
+		if v.Name == "right" && v.Value != 60 {
+			t.Error("Unmarshaled stay should keep right at 60, was", v.Value)
+		}
+	}
+
+	encoded, err := EncodeTableau(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, _, err := DecodeTableau(encoded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Stays()) != 1 || decoded.ConstraintCount() != 2 {
+		t.Error("Decoded solver does not match original one")
+	}
+
+	if err := s.RemoveStay(right.Variable); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveStay(right.Variable); err == nil {
+		t.Error("Removing an unknown stay should fail")
+	}
+	s.FlushUpdates()
+	expect(t, right, 100)
+}
+
+func TestEditSession(t *testing.T) {
+	s := NewSolver()
+	left := NewParam(0)
+	right := NewParam(0)
+	s.AddConstraint(right.GreaterThanOrEqualTo(left.Add(CM(10))))
+	s.AddStay(left.Variable, PriorityWeak)
+	s.AddStay(right.Variable, PriorityWeak)
+	s.FlushUpdates()
+	expect(t, right, 10)
+
+	session, err := s.BeginEdit(map[*Variable]Priority{left.Variable: PriorityStrong})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.EditVariableCount() != 1 {
+		t.Error("BeginEdit should add the edit variables")
+	}
+	if err := session.Suggest(right.Variable, 0); err == nil {
+		t.Error("Suggesting a variable outside the session should fail")
+	}
+
+	session.Suggest(left.Variable, 50)
+	session.Resolve()
+	expect(t, left, 50)
+	expect(t, right, 60)
+
+	session.Suggest(left.Variable, 20)
+	if _, err := session.End(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, left, 20)
+	expect(t, right, 60)
+
+	if s.EditVariableCount() != 0 || len(s.Stays()) != 2 {
+		t.Error("End should remove the edit variables but keep the stays")
+	}
+	if _, err := session.End(); err == nil {
+		t.Error("Ending a session twice should fail")
+	}
+	if err := session.Suggest(left.Variable, 0); err == nil {
+		t.Error("Suggesting after the end of a session should fail")
+	}
+
+	s.AddEditVariable(right.Variable, float64(PriorityStrong))
+	if _, err := s.BeginEdit(map[*Variable]Priority{left.Variable: PriorityStrong, right.Variable: PriorityStrong}); err == nil {
+		t.Error("BeginEdit with an edited variable should fail")
+	}
+	if s.EditVariableCount() != 1 {
+		t.Error("Failing BeginEdit should not add any edit variables")
+	}
+	if err := s.RemoveEditVariable(right.Variable); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveEditVariable(right.Variable); err == nil {
+		t.Error("Removing an unknown edit variable should fail")
+	}
+}
+
+func TestIntegralUpdates(t *testing.T) {
+	s := NewSolver()
+	a := NewParam(0)
+	b := NewParam(0)
+	c := NewParam(0)
+	d := NewParam(0)
+	b.Variable.Integral = true
+	c.Variable.Integral = true
+
+	s.AddConstraint(a.Equals(CM(0)))
+	s.AddConstraint(d.Equals(CM(100)))
+	first := b.Sub(a).Equals(c.Sub(b))
+	first.Priority = PriorityStrong
+	second := c.Sub(b).Equals(d.Sub(c))
+	second.Priority = PriorityStrong
+	s.AddConstraints(first, second)
+
+	_, report := s.FlushIntegralUpdates(100)
+	if !report.Exact || !report.Optimal || report.Nodes == 0 {
+		t.Error("Unexpected report", report)
+	}
+	if b.Value() != math.Round(b.Value()) || c.Value() != math.Round(c.Value()) {
+		t.Error("Values should be integral, were", b.Value(), c.Value())
+	}
+	if b.Value() < 33 || b.Value() > 34 || c.Value() < 66 || c.Value() > 67 {
+		t.Error("Values should stay near the fractional solution, were", b.Value(), c.Value())
+	}
+	if value := s.ValueOf(b.Variable); math.Abs(value-100.0/3) > 1e-6 {
+		t.Error("The tableau should not be changed, value was", value)
+	}
+
+	s.FlushUpdates()
+	if math.Abs(b.Value()-100.0/3) > 1e-6 {
+		t.Error("FlushUpdates should not round, value was", b.Value())
+	}
+
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, variables, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integral := 0
+	for _, v := range variables {
+		if v.Integral {
+			integral++
+		}
+	}
+	if integral != 2 {
+		t.Error("Unmarshaled variables should keep being integral")
+	}
+
+	// existing variables get the encoded flags as well
+	b.Variable.Name = "b"
+	d.Variable.Name = "d"
+	encoded, err := EncodeTableau(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := map[string]*Variable{"b": NewParam(0).Variable, "d": NewParam(0).Variable}
+	existing["d"].Integral = true
+	if _, _, _, err := DecodeTableau(encoded, existing); err != nil {
+		t.Fatal(err)
+	}
+	if !existing["b"].Integral || existing["d"].Integral {
+		t.Error("Decoded variables should have the encoded integral flags")
+	}
+
+	// 2x == 1 has no integral solution
+	s = NewSolver()
+	x := NewParam(0)
+	x.Variable.Integral = true
+	half := x.Mult(CM(2)).Equals(CM(1))
+	s.AddConstraint(half)
+	_, report = s.FlushIntegralUpdates(100)
+	if report.Exact || len(report.Rounded) != 1 || report.Rounded[0] != x.Variable {
+		t.Error("Infeasible problems should be rounded", report)
+	}
+	if len(report.Violated) != 1 || report.Violated[0] != half {
+		t.Error("Rounding should report the broken constraint", report.Violated)
+	}
+	expect(t, x, 1)
+}
+
+func TestIntegralUpdatesLeaveTableau(t *testing.T) {
+	// the pivots depend on the map order, so the search is repeated on several solvers
+	for i := 0; i < 10; i++ {
+		x := NewParam(0)
+		y := NewParam(0)
+		z := NewParam(0)
+
+		s := NewSolver()
+		for _, p := range []*Param{x, y, z} {
+			p.Variable.Integral = true
+			s.AddConstraint(p.GreaterThanOrEqualTo(CM(0)))
+		}
+		s.AddConstraint(x.Add(y).Add(z).Equals(CM(5.5)))
+
+		// every split of the sum is optimal, so only the exact tableau keeps the values
+		values := func() []float64 {
+			return []float64{s.ValueOf(x.Variable), s.ValueOf(y.Variable), s.ValueOf(z.Variable)}
+		}
+		initial := values()
+
+		s.FlushIntegralUpdates(50)
+		if current := values(); !reflect.DeepEqual(current, initial) {
+			t.Fatal("Branch and bound should leave the tableau unchanged", initial, "got", current)
+		}
+
+		tx := s.Begin()
+		s.FlushIntegralUpdates(50)
+		if len(s.scopes) != 1 || len(s.undo) != 0 {
+			t.Fatal("Branch and bound should not log anything within the Transaction")
+		}
+		tx.Commit()
+	}
+}
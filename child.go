@@ -0,0 +1,93 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ChildSolver solves the layout of a component in a Solver of its own. Only its boundary variables
+// are connected to the parent Solver: inputs are suggested into the child whenever their value within
+// the parent changes, outputs are suggested into the parent.
+type ChildSolver struct {
+	*Solver
+
+	parent  *Solver
+	inputs  []*binding
+	outputs []*binding
+	dirty   bool
+}
+
+// binding connects a variable of one Solver to an edit variable of another
+type binding struct {
+	source *Variable
+	target *Variable
+	value  float64
+}
+
+// NewChild creates a ChildSolver with an empty Solver for the given parent
+func NewChild(parent *Solver) *ChildSolver {
+	return &ChildSolver{
+		Solver: NewSolver(),
+		parent: parent,
+		dirty:  true,
+	}
+}
+
+// BindInput makes childVar follow the value of parentVar with the given priority
+func (c *ChildSolver) BindInput(parentVar, childVar *Variable, priority Priority) error {
+	if err := c.AddEditVariable(childVar, float64(priority)); err != nil {
+		return errors.Wrap(err, "Could not bind input")
+	}
+
+	c.inputs = append(c.inputs, &binding{source: parentVar, target: childVar})
+	c.dirty = true
+	return nil
+}
+
+// BindOutput makes parentVar follow the value of childVar with the given priority
+func (c *ChildSolver) BindOutput(childVar, parentVar *Variable, priority Priority) error {
+	if err := c.parent.AddEditVariable(parentVar, float64(priority)); err != nil {
+		return errors.Wrap(err, "Could not bind output")
+	}
+
+	c.outputs = append(c.outputs, &binding{source: childVar, target: parentVar})
+	c.dirty = true
+	return nil
+}
+
+// Invalidate makes the next Update re-solve the child, e.g. after its constraints were changed
+func (c *ChildSolver) Invalidate() {
+	c.dirty = true
+}
+
+// Update suggests the inputs which changed within the parent into the child and pushes the resulting
+// outputs into the parent. If nothing changed since the last Update, the child is left alone and nil is
+// returned, otherwise the updates of the child's variables. The parent still has to be flushed afterwards.
+func (c *ChildSolver) Update() []*Update {
+	changed := c.dirty
+	for _, input := range c.inputs {
+		if value := c.parent.ValueOf(input.source); c.dirty || value != input.value {
+			input.value = value
+			c.SuggestValueForVariable(input.target, value)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	c.dirty = false
+
+	for _, output := range c.outputs {
+		value := c.ValueOf(output.source)
+		if value != output.value {
+			output.value = value
+			c.parent.SuggestValueForVariable(output.target, value)
+		}
+	}
+
+	return c.FlushUpdates()
+}
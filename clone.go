@@ -0,0 +1,120 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"container/list"
+
+	"github.com/monkey-works/cassowary/internal"
+)
+
+// Clone creates an independent copy of the Solver with the same constraints, edit variables, stays and
+// tableau, so no pivoting is necessary to rebuild it. Every variable contained in mapping is replaced
+// by its counterpart within the copy; all other variables are shared, so FlushUpdates of either Solver
+// writes to them. Constraints and objectives are always copied, the returned map leads from the original
+// constraints to their copies.
+func (s *Solver) Clone(mapping map[*Variable]*Variable) (*Solver, map[*Constraint]*Constraint) {
+	clone := &Solver{
+		infeasibleRows:  list.New(),
+		rejectRedundant: s.rejectRedundant,
+		hierarchical:    s.hierarchical,
+		quadratic:       s.quadratic,
+	}
+	clone.restoreState(s.captureState())
+
+	remapVariable := func(v *Variable) *Variable {
+		if mapped, ok := mapping[v]; ok {
+			return mapped
+		}
+		return v
+	}
+
+	remapExpression := func(expression *Expression) *Expression {
+		terms := make([]*Term, len(expression.terms))
+		for i, term := range expression.terms {
+			terms[i] = NewTerm(remapVariable(term.variable), term.coefficient)
+		}
+		return NewExpression(terms, expression.constant)
+	}
+
+	constraints := make(map[*Constraint]*Constraint, len(clone.constraints))
+	remapConstraint := func(c *Constraint) *Constraint {
+		if mapped, ok := constraints[c]; ok {
+			return mapped
+		}
+
+		mapped := NewConstraint(remapExpression(c.expression), c.relation)
+		mapped.Priority = c.Priority
+		constraints[c] = mapped
+		return mapped
+	}
+
+	tags := make(map[*Constraint]*internal.Tag, len(clone.constraints))
+	order := make(map[*Constraint]uint64, len(clone.constraints))
+	for constraint, tag := range clone.constraints {
+		mapped := remapConstraint(constraint)
+		tags[mapped] = tag
+		order[mapped] = clone.order[constraint]
+	}
+	clone.constraints = tags
+	clone.order = order
+
+	variables := make(map[*Variable]*internal.Symbol, len(clone.variables))
+	variableOrder := make(map[*Variable]uint64, len(clone.variables))
+	for variable, symbol := range clone.variables {
+		variables[remapVariable(variable)] = symbol
+		variableOrder[remapVariable(variable)] = clone.variableOrder[variable]
+	}
+	clone.variables = variables
+	clone.variableOrder = variableOrder
+
+	goals := make(map[*Objective]uint64, len(clone.goals))
+	for objective, order := range clone.goals {
+		goals[&Objective{
+			expression: remapExpression(objective.expression),
+			priority:   objective.priority,
+			maximize:   objective.maximize,
+		}] = order
+	}
+	clone.goals = goals
+	clone.countReferences()
+
+	remapEdits := func(infos map[*Variable]*editInfo) map[*Variable]*editInfo {
+		result := make(map[*Variable]*editInfo, len(infos))
+		for variable, info := range infos {
+			info.constraint = remapConstraint(info.constraint)
+			bands := make([]*Constraint, len(info.bands))
+			for i, band := range info.bands {
+				bands[i] = remapConstraint(band)
+			}
+			info.bands = bands
+			result[remapVariable(variable)] = info
+		}
+		return result
+	}
+	clone.edits = remapEdits(clone.edits)
+	clone.stays = remapEdits(clone.stays)
+
+	for i, redundancy := range clone.redundancies {
+		implied := make([]*Constraint, len(redundancy.ImpliedBy))
+		for j, other := range redundancy.ImpliedBy {
+			implied[j] = remapConstraint(other)
+		}
+		clone.redundancies[i] = &Redundancy{
+			Constraint: remapConstraint(redundancy.Constraint),
+			ImpliedBy:  implied,
+		}
+	}
+
+	edited := clone.internalConstraints()
+	result := make(map[*Constraint]*Constraint, len(constraints))
+	for original, mapped := range constraints {
+		if !edited[mapped] {
+			result[original] = mapped
+		}
+	}
+
+	return clone, result
+}
@@ -4,6 +4,10 @@
 
 package cassowary
 
+import (
+	"github.com/pkg/errors"
+)
+
 type Relation int
 
 const (
@@ -20,6 +24,39 @@ type Constraint struct {
 	Priority Priority
 }
 
+var relationSymbols = map[Relation]string{
+	EqualTo:              "==",
+	LessThanOrEqualTo:    "<=",
+	GreaterThanOrEqualTo: ">=",
+}
+
+// String returns the mathematical symbol of the relation
+func (r Relation) String() string {
+	if symbol, ok := relationSymbols[r]; ok {
+		return symbol
+	}
+	return "?"
+}
+
+// MarshalText encodes the relation as its mathematical symbol
+func (r Relation) MarshalText() ([]byte, error) {
+	if _, ok := relationSymbols[r]; !ok {
+		return nil, errors.Errorf("Unknown relation %d", int(r))
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a relation from its mathematical symbol
+func (r *Relation) UnmarshalText(text []byte) error {
+	for relation, symbol := range relationSymbols {
+		if symbol == string(text) {
+			*r = relation
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown relation %q", string(text))
+}
+
 func NewConstraint(exp *Expression, rel Relation) *Constraint {
 	return &Constraint{
 		relation:   rel,
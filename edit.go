@@ -0,0 +1,113 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// EditSession is a group of edit variables which exist for the duration of an interaction like a drag.
+// It is started by BeginEdit and finished by End, which removes its edit variables again.
+type EditSession struct {
+	solver    *Solver
+	variables []*Variable
+	members   map[*Variable]bool
+	ended     bool
+
+	// mutex guards the methods of EditSessions begun by a SyncSolver
+	mutex sync.Locker
+}
+
+// BeginEdit adds all variables as edit variables with the given priorities, starting at their current
+// values, so nothing moves until the first suggestion. If any of them cannot be added, none are.
+func (s *Solver) BeginEdit(variables map[*Variable]Priority) (*EditSession, error) {
+	session := &EditSession{
+		solver:    s,
+		variables: make([]*Variable, 0, len(variables)),
+		members:   make(map[*Variable]bool, len(variables)),
+	}
+	for v := range variables {
+		session.variables = append(session.variables, v)
+		session.members[v] = true
+	}
+	sort.Slice(session.variables, func(i, j int) bool {
+		return session.variables[i].Name < session.variables[j].Name
+	})
+
+	for _, v := range session.variables {
+		if _, ok := s.edits[v]; ok {
+			return nil, errors.New("DUPLICATE")
+		}
+		if priority := variables[v]; priority < 0 || priority >= PriorityRequired {
+			return nil, errors.New("Bad Priority")
+		}
+	}
+
+	for i, v := range session.variables {
+		if err := s.AddEditVariable(v, float64(variables[v])); err != nil {
+			for _, added := range session.variables[:i] {
+				s.RemoveEditVariable(added)
+			}
+			return nil, err
+		}
+		s.SuggestValueForVariable(v, v.Value)
+	}
+
+	return session, nil
+}
+
+// Suggest suggests a value for one of the variables of the session
+func (e *EditSession) Suggest(v *Variable, value float64) error {
+	if e.mutex != nil {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+	}
+
+	if e.ended {
+		return errors.New("Edit session ended")
+	}
+	if !e.members[v] {
+		return errors.New("Unknown edit variable")
+	}
+
+	e.solver.SuggestValueForVariable(v, value)
+	return nil
+}
+
+// Resolve flushes the suggestions made so far, see Solver.FlushUpdates
+func (e *EditSession) Resolve() []*Update {
+	if e.mutex != nil {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+	}
+
+	return e.solver.FlushUpdates()
+}
+
+// End resolves the pending suggestions, so stays are moved to the edited values, and removes the edit
+// variables of the session. It returns the updates of the resulting solution.
+func (e *EditSession) End() ([]*Update, error) {
+	if e.mutex != nil {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+	}
+
+	if e.ended {
+		return nil, errors.New("Edit session ended")
+	}
+	e.ended = true
+
+	e.solver.FlushUpdates()
+	for _, v := range e.variables {
+		if err := e.solver.RemoveEditVariable(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.solver.FlushUpdates(), nil
+}
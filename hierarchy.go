@@ -0,0 +1,100 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+
+	"github.com/monkey-works/cassowary/internal"
+)
+
+// NewHierarchicalSolver creates a Solver which treats priorities as a strict hierarchy instead of weights.
+// Every distinct priority gets an objective of its own and the objectives are minimized lexicographically,
+// so a constraint always wins against any number of constraints with a lower priority.
+func NewHierarchicalSolver() *Solver {
+	s := NewSolver()
+	s.hierarchical = true
+	s.levels = make(map[Priority]*internal.Row)
+	return s
+}
+
+// IsHierarchical returns true if the Solver was created by NewHierarchicalSolver
+func (s *Solver) IsHierarchical() bool {
+	return s.hierarchical
+}
+
+// objectiveFor returns the objective row the error symbols of the given priority are added to
+// together with the weight they get within that row
+func (s *Solver) objectiveFor(priority Priority) (*internal.Row, float64) {
+	if !s.hierarchical {
+		return s.objective, float64(priority)
+	}
+
+	level, ok := s.levels[priority]
+	if !ok {
+		level = internal.NewRow(0.0)
+		s.levels[priority] = level
+	}
+	return level, 1.0
+}
+
+// levelPriorities returns the priorities of all objective levels, strongest first
+func (s *Solver) levelPriorities() []Priority {
+	result := make([]Priority, 0, len(s.levels))
+	for priority := range s.levels {
+		result = append(result, priority)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] > result[j]
+	})
+	return result
+}
+
+// objectives returns all objective rows in the order they have to be minimized
+func (s *Solver) objectives() []*internal.Row {
+	if !s.hierarchical {
+		return []*internal.Row{s.objective}
+	}
+
+	priorities := s.levelPriorities()
+	result := make([]*internal.Row, len(priorities))
+	for i, priority := range priorities {
+		result[i] = s.levels[priority]
+	}
+	return result
+}
+
+// optimize minimizes all objectives of the Solver. Weaker levels may only be improved
+// by pivots which leave all stronger levels untouched.
+func (s *Solver) optimize() error {
+	objectives := s.objectives()
+
+	for i, objective := range objectives {
+		if err := s.optimizeObjectiveRow(objective, s.hasObjectiveTerms(objective), objectives[:i]...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasObjectiveTerms returns true if any Objective of the Solver contributes to the objective row
+func (s *Solver) hasObjectiveTerms(objective *internal.Row) bool {
+	for goal := range s.goals {
+		if !s.hierarchical || s.levels[goal.priority] == objective {
+			return true
+		}
+	}
+	return false
+}
+
+func lexicographicallyLess(a, b []float64) bool {
+	for i := range a {
+		if !internal.IsNearZero(a[i] - b[i]) {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+)
+
+// EditVariable describes a variable added by AddEditVariable
+type EditVariable struct {
+	Variable *Variable
+
+	Priority Priority
+
+	// Value is the value suggested last for the variable
+	Value float64
+}
+
+// Constraints returns all constraints added to the Solver in the order they were added.
+// The internal constraints of edit variables are not included.
+func (s *Solver) Constraints() []*Constraint {
+	edited := s.internalConstraints()
+
+	result := make([]*Constraint, 0, len(s.constraints)-len(edited))
+	for _, constraint := range s.orderedConstraints() {
+		if !edited[constraint] {
+			result = append(result, constraint)
+		}
+	}
+	return result
+}
+
+// ConstraintCount returns the number of constraints added to the Solver, not counting edit variables
+func (s *Solver) ConstraintCount() int {
+	return len(s.constraints) - len(s.internalConstraints())
+}
+
+// Variables returns all variables known to the Solver in the order they were first used
+func (s *Solver) Variables() []*Variable {
+	result := make([]*Variable, 0, len(s.variables))
+	for variable := range s.variables {
+		result = append(result, variable)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return s.variableOrder[result[i]] < s.variableOrder[result[j]]
+	})
+	return result
+}
+
+// VariableCount returns the number of variables known to the Solver
+func (s *Solver) VariableCount() int {
+	return len(s.variables)
+}
+
+// EditVariables returns all edit variables of the Solver in the order they were added
+func (s *Solver) EditVariables() []*EditVariable {
+	result := make([]*EditVariable, 0, len(s.edits))
+	for variable, info := range s.edits {
+		result = append(result, &EditVariable{
+			Variable: variable,
+			Priority: info.constraint.Priority,
+			Value:    info.constant,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return s.order[s.edits[result[i].Variable].constraint] < s.order[s.edits[result[j].Variable].constraint]
+	})
+	return result
+}
+
+// EditVariableCount returns the number of edit variables of the Solver
+func (s *Solver) EditVariableCount() int {
+	return len(s.edits)
+}
@@ -0,0 +1,216 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"math"
+	"sort"
+
+	"github.com/monkey-works/cassowary/internal"
+)
+
+// IntegralReport describes how FlushIntegralUpdates found the values of the integral variables
+type IntegralReport struct {
+	// Exact is true if an integral solution satisfying all required constraints was found
+	Exact bool
+
+	// Optimal is true if the search completed within the node limit, so no integral solution has a
+	// smaller objective than the one found
+	Optimal bool
+
+	// Nodes is the number of relaxations solved during the search
+	Nodes int
+
+	// Rounded lists the integral variables which were rounded to the nearest integer regardless of the
+	// constraints, because no integral solution was found
+	Rounded []*Variable
+
+	// Violated lists the required constraints broken by rounding
+	Violated []*Constraint
+}
+
+// FlushIntegralUpdates updates the variables like FlushUpdates, but variables marked as Integral get
+// integral values. The solution is searched by branch and bound over the tableau, solving at most
+// nodeLimit relaxations. If no integral solution is found, e.g. because the constraints do not allow
+// for one, the integral variables are rounded and the report lists the constraints this breaks.
+// The tableau itself is left unchanged.
+func (s *Solver) FlushIntegralUpdates(nodeLimit int) ([]*Update, *IntegralReport) {
+	values, report := s.solveIntegral(nodeLimit)
+
+	result := make([]*Update, 0)
+	for variable := range s.variables {
+		variable.applyUpdate(values[variable])
+
+		if variable.owner != nil && variable.owner.Context != nil {
+			result = append(result, &Update{variable.owner.Context, variable.Value})
+		}
+	}
+
+	s.updateStays()
+
+	s.recorder.recordIntegralFlush(s, nodeLimit)
+
+	return result, report
+}
+
+// branchAndBound searches the integral solution with the smallest objective depth first
+type branchAndBound struct {
+	solver    *Solver
+	integral  []*Variable
+	limit     int
+	nodes     int
+	truncated bool
+	best      map[*Variable]float64
+	score     []float64
+}
+
+func (s *Solver) solveIntegral(nodeLimit int) (map[*Variable]float64, *IntegralReport) {
+	relaxed := s.currentValues()
+	report := &IntegralReport{}
+
+	integral := make([]*Variable, 0)
+	for variable := range s.variables {
+		if variable.Integral {
+			integral = append(integral, variable)
+		}
+	}
+	sort.Slice(integral, func(i, j int) bool {
+		return s.variableOrder[integral[i]] < s.variableOrder[integral[j]]
+	})
+
+	b := &branchAndBound{solver: s, integral: integral, limit: nodeLimit}
+	b.search()
+
+	report.Nodes = b.nodes
+	if b.best != nil {
+		report.Exact = true
+		report.Optimal = !b.truncated
+		return b.best, report
+	}
+
+	for _, variable := range integral {
+		rounded := math.Round(relaxed[variable])
+		if rounded != relaxed[variable] {
+			relaxed[variable] = rounded
+			report.Rounded = append(report.Rounded, variable)
+		}
+	}
+	report.Violated = s.violatedConstraints(relaxed)
+	return relaxed, report
+}
+
+func (b *branchAndBound) search() {
+	if b.nodes >= b.limit {
+		b.truncated = true
+		return
+	}
+	b.nodes++
+
+	// adding bounds never improves the objective, so nodes worse than the best solution are pruned
+	score := b.solver.objectiveScore()
+	if b.best != nil && !lessScore(score, b.score) {
+		return
+	}
+
+	values := b.solver.currentValues()
+	for _, variable := range b.integral {
+		value := values[variable]
+		if internal.IsNearZero(value - math.Round(value)) {
+			continue
+		}
+
+		// the nearer integer is tried first, so good solutions are found early
+		floor := math.Floor(value)
+		if value-floor < 0.5 {
+			b.branch(variable, floor, LessThanOrEqualTo)
+			b.branch(variable, floor+1, GreaterThanOrEqualTo)
+		} else {
+			b.branch(variable, floor+1, GreaterThanOrEqualTo)
+			b.branch(variable, floor, LessThanOrEqualTo)
+		}
+		return
+	}
+
+	for _, variable := range b.integral {
+		values[variable] = math.Round(values[variable])
+	}
+	b.best, b.score = values, score
+}
+
+// branch searches the solutions satisfying the bound `v <relation> bound`. Afterwards the tableau is
+// restored exactly, as removing the bound again could end up in another optimal basis.
+func (b *branchAndBound) branch(v *Variable, bound float64, relation Relation) {
+	s := b.solver
+	scope := s.beginUndo()
+	defer s.endUndo(scope, true)
+
+	constraint := NewConstraint(NewExpression([]*Term{NewTerm(v, 1.0)}, -bound), relation)
+	if err := s.addConstraint(constraint); err != nil {
+		return
+	}
+	b.search()
+}
+
+// currentValues returns the values of all variables within the tableau
+func (s *Solver) currentValues() map[*Variable]float64 {
+	result := make(map[*Variable]float64, len(s.variables))
+	for variable := range s.variables {
+		result[variable] = s.ValueOf(variable)
+	}
+	return result
+}
+
+// objectiveScore returns the objective of the current solution, one value per priority for
+// hierarchical solvers
+func (s *Solver) objectiveScore() []float64 {
+	if !s.hierarchical {
+		return []float64{s.ObjectiveValue()}
+	}
+
+	levels := s.ObjectiveLevels()
+	result := make([]float64, len(levels))
+	for i, level := range levels {
+		result[i] = level.Weighted
+	}
+	return result
+}
+
+// lessScore compares two objective scores lexicographically
+func lessScore(a, b []float64) bool {
+	for i := range a {
+		if i >= len(b) || internal.IsNearZero(a[i]-b[i]) {
+			continue
+		}
+		return a[i] < b[i]
+	}
+	return false
+}
+
+// violatedConstraints returns the required constraints not satisfied by the values
+func (s *Solver) violatedConstraints(values map[*Variable]float64) []*Constraint {
+	result := make([]*Constraint, 0)
+	for _, constraint := range s.orderedConstraints() {
+		if constraint.Priority < PriorityRequired {
+			continue
+		}
+
+		value := constraint.expression.constant
+		for _, term := range constraint.expression.terms {
+			value += term.coefficient * values[term.variable]
+		}
+
+		satisfied := internal.IsNearZero(value)
+		switch constraint.relation {
+		case LessThanOrEqualTo:
+			satisfied = satisfied || value < 0
+		case GreaterThanOrEqualTo:
+			satisfied = satisfied || value > 0
+		}
+		if !satisfied {
+			result = append(result, constraint)
+		}
+	}
+	return result
+}
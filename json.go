@@ -0,0 +1,378 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// jsonVersion is the version of the JSON schema written by Marshal. Every version only adds fields to
+// the previous one, so Unmarshal reads all versions up to this one and rejects newer ones.
+//
+//	1: variables, constraints and edit variables
+//	2: objectives
+//	3: quadratic errors of edit variables
+//	4: stays
+//	5: integral variables
+const jsonVersion = 5
+
+// jsonSystem is the JSON representation of all constraints and edit variables of a Solver, e.g.
+//
+//	{
+//	  "version": 5,
+//	  "variables": [{"id": 0, "name": "left", "value": 0}, {"id": 1, "name": "right", "value": 100}],
+//	  "constraints": [{"terms": [{"variable": 1, "coefficient": 1}, {"variable": 0, "coefficient": -1}],
+//	                   "constant": -100, "relation": ">=", "priority": "strong"}],
+//	  "edits": [{"variable": 0, "priority": "medium", "value": 0}],
+//	  "stays": [{"variable": 1, "priority": "weak", "value": 100}],
+//	  "objectives": [{"terms": [{"variable": 1, "coefficient": 1}], "constant": 0, "priority": "weak", "maximize": true}]
+//	}
+//
+// Constraints read `sum(coefficient*variable) + constant <relation> 0`. Edit variables and stays with a
+// quadratic error carry the step and segments they were added with, the quadratic mode of the system
+// applies to the ones added afterwards.
+type jsonSystem struct {
+	Version      int              `json:"version"`
+	Hierarchical bool             `json:"hierarchical,omitempty"`
+	Variables    []jsonVariable   `json:"variables"`
+	Constraints  []jsonConstraint `json:"constraints"`
+	Edits        []jsonEdit       `json:"edits,omitempty"`
+	Stays        []jsonEdit       `json:"stays,omitempty"`
+	Objectives   []jsonObjective  `json:"objectives,omitempty"`
+	Quadratic    *jsonQuadratic   `json:"quadratic,omitempty"`
+}
+
+type jsonVariable struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name,omitempty"`
+	Value    float64 `json:"value"`
+	Integral bool    `json:"integral,omitempty"`
+}
+
+type jsonTerm struct {
+	Variable    int     `json:"variable"`
+	Coefficient float64 `json:"coefficient"`
+}
+
+type jsonConstraint struct {
+	Terms    []jsonTerm `json:"terms"`
+	Constant float64    `json:"constant"`
+	Relation Relation   `json:"relation"`
+	Priority Priority   `json:"priority"`
+}
+
+type jsonObjective struct {
+	Terms    []jsonTerm `json:"terms"`
+	Constant float64    `json:"constant"`
+	Priority Priority   `json:"priority"`
+	Maximize bool       `json:"maximize,omitempty"`
+}
+
+type jsonQuadratic struct {
+	Step     float64 `json:"step"`
+	Segments int     `json:"segments"`
+}
+
+type jsonEdit struct {
+	Variable  int            `json:"variable"`
+	Priority  Priority       `json:"priority"`
+	Value     float64        `json:"value"`
+	Quadratic *jsonQuadratic `json:"quadratic,omitempty"`
+}
+
+// jsonVariables assigns ids to variables in the order they are encountered
+type jsonVariables struct {
+	ids       map[*Variable]int
+	variables []jsonVariable
+}
+
+func newJSONVariables() *jsonVariables {
+	return &jsonVariables{
+		ids:       make(map[*Variable]int),
+		variables: make([]jsonVariable, 0),
+	}
+}
+
+func (v *jsonVariables) id(variable *Variable) int {
+	if id, ok := v.ids[variable]; ok {
+		return id
+	}
+
+	id := len(v.variables)
+	v.ids[variable] = id
+	v.variables = append(v.variables, jsonVariable{
+		ID:       id,
+		Name:     variable.Name,
+		Value:    variable.Value,
+		Integral: variable.Integral,
+	})
+	return id
+}
+
+func (v *jsonVariables) constraint(c *Constraint) jsonConstraint {
+	return jsonConstraint{
+		Terms:    v.terms(c.expression),
+		Constant: c.expression.constant,
+		Relation: c.relation,
+		Priority: c.Priority,
+	}
+}
+
+func (v *jsonVariables) objective(o *Objective) jsonObjective {
+	return jsonObjective{
+		Terms:    v.terms(o.expression),
+		Constant: o.expression.constant,
+		Priority: o.priority,
+		Maximize: o.maximize,
+	}
+}
+
+func (v *jsonVariables) terms(expression *Expression) []jsonTerm {
+	result := make([]jsonTerm, len(expression.terms))
+	for i, term := range expression.terms {
+		result[i] = jsonTerm{
+			Variable:    v.id(term.variable),
+			Coefficient: term.coefficient,
+		}
+	}
+	return result
+}
+
+// Marshal encodes all constraints, edit variables and objectives of the Solver together with the names and
+// current values of their variables as JSON. The result can be loaded by Unmarshal.
+func Marshal(s *Solver) ([]byte, error) {
+	system, _ := s.encodeJSONSystem(newJSONVariables())
+
+	// relations should stay readable, so they must not be escaped
+	result := &bytes.Buffer{}
+	encoder := json.NewEncoder(result)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(system); err != nil {
+		return nil, err
+	}
+	return result.Bytes(), nil
+}
+
+// Unmarshal creates a new Solver from JSON written by Marshal. The returned variables are ordered
+// by their id and carry the names and values they had when being marshaled.
+func Unmarshal(data []byte) (*Solver, []*Variable, error) {
+	system := &jsonSystem{}
+	if err := json.Unmarshal(data, system); err != nil {
+		return nil, nil, err
+	}
+
+	s, variables, _, err := decodeJSONSystem(system)
+	return s, variables, err
+}
+
+// encodeJSONSystem describes the Solver using the given variable ids. The constraints which are not
+// part of edit variables are returned in the order they appear within the system.
+func (s *Solver) encodeJSONSystem(variables *jsonVariables) (*jsonSystem, []*Constraint) {
+	edits := make(map[*Constraint]*Variable, len(s.edits))
+	for variable, info := range s.edits {
+		edits[info.constraint] = variable
+	}
+	stays := make(map[*Constraint]*Variable, len(s.stays))
+	for variable, info := range s.stays {
+		stays[info.constraint] = variable
+	}
+	edited := s.internalConstraints()
+
+	system := &jsonSystem{
+		Version:      jsonVersion,
+		Hierarchical: s.hierarchical,
+		Constraints:  make([]jsonConstraint, 0, len(s.constraints)),
+	}
+	constraints := make([]*Constraint, 0, len(s.constraints))
+
+	for _, constraint := range s.orderedConstraints() {
+		if variable, ok := edits[constraint]; ok {
+			system.Edits = append(system.Edits, jsonEdit{
+				Variable:  variables.id(variable),
+				Priority:  constraint.Priority,
+				Value:     s.edits[variable].constant,
+				Quadratic: encodeJSONQuadratic(s.edits[variable].quadraticMode()),
+			})
+			continue
+		}
+		if variable, ok := stays[constraint]; ok {
+			system.Stays = append(system.Stays, jsonEdit{
+				Variable:  variables.id(variable),
+				Priority:  constraint.Priority,
+				Value:     s.stays[variable].constant,
+				Quadratic: encodeJSONQuadratic(s.stays[variable].quadraticMode()),
+			})
+			continue
+		}
+		if edited[constraint] {
+			// the bands of quadratic edits and stays are created anew together with them
+			continue
+		}
+
+		system.Constraints = append(system.Constraints, variables.constraint(constraint))
+		constraints = append(constraints, constraint)
+	}
+	for _, objective := range s.orderedObjectives() {
+		system.Objectives = append(system.Objectives, variables.objective(objective))
+	}
+	system.Quadratic = encodeJSONQuadratic(s.quadratic)
+	system.Variables = make([]jsonVariable, len(variables.variables))
+	copy(system.Variables, variables.variables)
+
+	return system, constraints
+}
+
+// decodeJSONSystem creates a new Solver from a system. Variables and constraints are returned in
+// the order they appear within the system.
+func decodeJSONSystem(system *jsonSystem) (*Solver, []*Variable, []*Constraint, error) {
+	if system.Version < 1 || system.Version > jsonVersion {
+		return nil, nil, nil, errors.Errorf("Unsupported version %d", system.Version)
+	}
+
+	variables := make([]*Variable, 0, len(system.Variables))
+	for _, v := range system.Variables {
+		var err error
+		if variables, err = declareJSONVariable(variables, v); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	s := NewSolver()
+	if system.Hierarchical {
+		s = NewHierarchicalSolver()
+	}
+
+	constraints := make([]*Constraint, len(system.Constraints))
+	for i, c := range system.Constraints {
+		constraint, err := decodeJSONConstraint(variables, c)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		constraints[i] = constraint
+
+		if err := s.addConstraint(constraint); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "Could not add constraint %d", i)
+		}
+	}
+
+	if system.Quadratic != nil {
+		if err := s.setQuadraticEdits(system.Quadratic.Step, system.Quadratic.Segments); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	for _, edit := range system.Edits {
+		v, err := variableForID(variables, edit.Variable)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		mode, err := decodeJSONQuadratic(edit.Quadratic)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := s.addEditVariable(v, float64(edit.Priority), mode); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "Could not add edit variable %d", edit.Variable)
+		}
+		s.suggestValueForEditInfoWithoutDualOptimization(s.edits[v], edit.Value)
+		s.dualOptimize()
+	}
+
+	for _, stay := range system.Stays {
+		v, err := variableForID(variables, stay.Variable)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		mode, err := decodeJSONQuadratic(stay.Quadratic)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := s.addStay(v, stay.Priority, mode); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "Could not add stay %d", stay.Variable)
+		}
+		s.suggestValueForEditInfoWithoutDualOptimization(s.stays[v], stay.Value)
+		s.dualOptimize()
+	}
+
+	for i, o := range system.Objectives {
+		objective, err := decodeJSONObjective(variables, o)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := s.addObjective(objective); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "Could not add objective %d", i)
+		}
+	}
+
+	return s, variables, constraints, nil
+}
+
+func encodeJSONQuadratic(mode *quadraticMode) *jsonQuadratic {
+	if mode == nil {
+		return nil
+	}
+	return &jsonQuadratic{Step: mode.step, Segments: mode.segments}
+}
+
+func decodeJSONQuadratic(q *jsonQuadratic) (*quadraticMode, error) {
+	if q == nil {
+		return nil, nil
+	}
+	return newQuadraticMode(q.Step, q.Segments)
+}
+
+func declareJSONVariable(variables []*Variable, v jsonVariable) ([]*Variable, error) {
+	if v.ID != len(variables) {
+		return variables, errors.Errorf("Unexpected variable id %d", v.ID)
+	}
+
+	variable := NewParam(v.Value).Variable
+	variable.Name = v.Name
+	variable.Integral = v.Integral
+	return append(variables, variable), nil
+}
+
+func variableForID(variables []*Variable, id int) (*Variable, error) {
+	if id < 0 || id >= len(variables) {
+		return nil, errors.Errorf("Unknown variable id %d", id)
+	}
+	return variables[id], nil
+}
+
+func decodeJSONConstraint(variables []*Variable, c jsonConstraint) (*Constraint, error) {
+	expression, err := decodeJSONExpression(variables, c.Terms, c.Constant)
+	if err != nil {
+		return nil, err
+	}
+
+	constraint := NewConstraint(expression, c.Relation)
+	constraint.Priority = c.Priority
+	return constraint, nil
+}
+
+func decodeJSONObjective(variables []*Variable, o jsonObjective) (*Objective, error) {
+	expression, err := decodeJSONExpression(variables, o.Terms, o.Constant)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Objective{expression: expression, priority: o.Priority, maximize: o.Maximize}, nil
+}
+
+func decodeJSONExpression(variables []*Variable, jsonTerms []jsonTerm, constant float64) (*Expression, error) {
+	terms := make([]*Term, len(jsonTerms))
+	for i, term := range jsonTerms {
+		v, err := variableForID(variables, term.Variable)
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = NewTerm(v, term.Coefficient)
+	}
+
+	return NewExpression(terms, constant), nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// Objective is a linear expression the Solver minimizes or maximizes in addition to the errors of its
+// constraints. The priority weighs the expression against these errors just like the priority of a
+// constraint does.
+//
+// Removing a constraint which bounds an Objective, or weakening its priority below the one of the
+// Objective, is rejected with an error and leaves the constraint unchanged.
+type Objective struct {
+	expression *Expression
+	priority   Priority
+	maximize   bool
+}
+
+// Expression returns the expression of the Objective
+func (o *Objective) Expression() *Expression {
+	return o.expression
+}
+
+// Priority returns the priority of the Objective
+func (o *Objective) Priority() Priority {
+	return o.priority
+}
+
+// IsMaximized returns true if the Objective was added by Maximize
+func (o *Objective) IsMaximized() bool {
+	return o.maximize
+}
+
+// sign is the factor the expression of the Objective is minimized with
+func (o *Objective) sign() float64 {
+	if o.maximize {
+		return -1.0
+	}
+	return 1.0
+}
+
+// Minimize adds the expression to the objective of the Solver. If the expression can be decreased
+// without bounds, nothing is changed and an error is returned.
+func (s *Solver) Minimize(expression *Expression, priority Priority) (*Objective, error) {
+	return s.AddObjective(&Objective{expression: expression, priority: priority})
+}
+
+// Maximize adds the negated expression to the objective of the Solver. If the expression can be
+// increased without bounds, nothing is changed and an error is returned.
+func (s *Solver) Maximize(expression *Expression, priority Priority) (*Objective, error) {
+	return s.AddObjective(&Objective{expression: expression, priority: priority, maximize: true})
+}
+
+// AddObjective adds an Objective which was removed before, or taken from another Solver
+func (s *Solver) AddObjective(objective *Objective) (*Objective, error) {
+	err := s.addObjective(objective)
+	s.recorder.recordObjective(objective, err)
+	if err != nil {
+		return nil, err
+	}
+	return objective, nil
+}
+
+func (s *Solver) addObjective(objective *Objective) error {
+	if _, ok := s.goals[objective]; ok {
+		return errors.New("duplicate")
+	}
+
+	if objective.priority < 0 || objective.priority >= PriorityRequired {
+		return errors.New("Bad Priority")
+	}
+
+	return s.atomically(func() error {
+		s.retain(variablesOfExpression(objective.expression))
+		s.goals[objective] = s.nextOrder
+		s.nextOrder++
+		s.insertObjectiveEffects(objective, 1.0)
+		s.logUndo(func() {
+			delete(s.goals, objective)
+		})
+
+		return s.optimize()
+	})
+}
+
+// RemoveObjective removes an Objective added by Minimize or Maximize. If the remaining objectives
+// become unbounded, nothing is changed and an error is returned.
+func (s *Solver) RemoveObjective(objective *Objective) error {
+	err := s.removeObjective(objective)
+	s.recorder.recordHandle(opRemoveObjective, objective, err)
+	return err
+}
+
+func (s *Solver) removeObjective(objective *Objective) error {
+	if _, ok := s.goals[objective]; !ok {
+		return errors.New("Unknown objective")
+	}
+
+	return s.atomically(func() error {
+		order := s.goals[objective]
+		s.insertObjectiveEffects(objective, -1.0)
+		delete(s.goals, objective)
+		s.logUndo(func() {
+			s.goals[objective] = order
+		})
+		s.release(variablesOfExpression(objective.expression))
+
+		return s.optimize()
+	})
+}
+
+// Objectives returns all objectives of the Solver in the order they were added
+func (s *Solver) Objectives() []*Objective {
+	return s.orderedObjectives()
+}
+
+func (s *Solver) orderedObjectives() []*Objective {
+	result := make([]*Objective, 0, len(s.goals))
+	for objective := range s.goals {
+		result = append(result, objective)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return s.goals[result[i]] < s.goals[result[j]]
+	})
+	return result
+}
+
+// insertObjectiveEffects adds the weighted expression of the Objective, expressed in nonbasic symbols,
+// to the objective row of its priority
+func (s *Solver) insertObjectiveEffects(o *Objective, factor float64) {
+	objective, weight := s.objectiveFor(o.priority)
+	factor *= o.sign()
+
+	for _, term := range FromExpression(o.expression).terms {
+		if internal.IsNearZero(term.coefficient) {
+			continue
+		}
+
+		coefficient := factor * weight * term.coefficient
+		symbol := s.symbolForVariable(term.variable)
+		if row, ok := s.rows[symbol]; ok {
+			s.saveInsertion(objective, nil, row)
+			objective.InsertRow(row, coefficient)
+		} else {
+			s.saveCell(objective, symbol)
+			objective.InsertSymbol(symbol, coefficient)
+		}
+	}
+}
+
+// ObjectiveLevel is the part of the objective contributed by the soft constraints and objectives of a
+// single priority
+type ObjectiveLevel struct {
+	Priority Priority
+
+	// Value is the total error of the soft constraints plus the values of the objectives, not weighted
+	// by the priority
+	Value float64
+
+	// Weighted is the Value weighted by the priority as done by the Solver
+	Weighted float64
+}
+
+// ObjectiveValue returns the value of the objective the Solver minimizes: the total weighted error of
+// all soft constraints plus the weighted values of all objectives. As hierarchical solvers do not weigh
+// priorities against each other, their solutions are better compared by ObjectiveLevels.
+func (s *Solver) ObjectiveValue() float64 {
+	result := 0.0
+	for _, level := range s.ObjectiveLevels() {
+		result += level.Weighted
+	}
+	return result
+}
+
+// ObjectiveLevels breaks the objective down by priority, strongest first
+func (s *Solver) ObjectiveLevels() []*ObjectiveLevel {
+	result := make([]*ObjectiveLevel, 0)
+	for priority, terms := range s.objectiveTerms() {
+		level := &ObjectiveLevel{Priority: priority}
+		for symbol, coefficient := range terms {
+			if row, ok := s.rows[symbol]; ok {
+				level.Value += coefficient * row.Constant
+			}
+		}
+		for objective := range s.goals {
+			if objective.priority == priority {
+				level.Value += objective.sign() * objective.expression.constant
+			}
+		}
+
+		level.Weighted = level.Value
+		if !s.hierarchical {
+			level.Weighted *= float64(priority)
+		}
+		result = append(result, level)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Priority > result[j].Priority
+	})
+	return result
+}
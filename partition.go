@@ -0,0 +1,369 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PartitionedSolver keeps every connected component of the graph of variables and constraints in
+// a Solver of its own, so changes within one component never touch the tableaus of the others.
+// Components are merged as soon as a constraint links them. They are not split again when
+// constraints are removed, but a component is dropped once it is empty.
+type PartitionedSolver struct {
+	// Parallel solves the components affected by an operation concurrently
+	Parallel bool
+
+	components  map[*component]bool
+	variables   map[*Variable]*component
+	constraints map[*Constraint]*component
+	nextID      uint64
+}
+
+type component struct {
+	id     uint64
+	solver *Solver
+}
+
+// partitionChange collects everything a bulk operation does to a single component
+type partitionChange struct {
+	target      *component
+	absorbed    []*component
+	constraints []*Constraint
+	tx          *Transaction
+}
+
+func NewPartitionedSolver() *PartitionedSolver {
+	return &PartitionedSolver{
+		components:  make(map[*component]bool),
+		variables:   make(map[*Variable]*component),
+		constraints: make(map[*Constraint]*component),
+	}
+}
+
+// ComponentCount returns the number of independent components
+func (p *PartitionedSolver) ComponentCount() int {
+	return len(p.components)
+}
+
+func (p *PartitionedSolver) newComponent() *component {
+	c := &component{id: p.nextID, solver: NewSolver()}
+	p.nextID++
+	return c
+}
+
+func (p *PartitionedSolver) AddConstraint(constraint *Constraint) error {
+	return p.AddConstraints(constraint)
+}
+
+// AddConstraints adds all constraints atomically, merging the components they link
+func (p *PartitionedSolver) AddConstraints(constraints ...*Constraint) error {
+	fresh := make(map[*Variable]*component)
+	lookup := func(v *Variable) *component {
+		if c, ok := p.variables[v]; ok {
+			return c
+		}
+		if c, ok := fresh[v]; ok {
+			return c
+		}
+		c := p.newComponent()
+		fresh[v] = c
+		return c
+	}
+
+	parent := make(map[*component]*component)
+	var find func(*component) *component
+	find = func(c *component) *component {
+		if next, ok := parent[c]; ok && next != c {
+			root := find(next)
+			parent[c] = root
+			return root
+		}
+		return c
+	}
+
+	owners := make([]*component, len(constraints))
+	for i, constraint := range constraints {
+		if _, ok := p.constraints[constraint]; ok {
+			return errors.New("duplicate")
+		}
+
+		variables := variablesOf(constraint)
+		if len(variables) == 0 {
+			owners[i] = p.newComponent()
+			continue
+		}
+
+		owners[i] = lookup(variables[0])
+		for _, v := range variables[1:] {
+			root, other := find(owners[i]), find(lookup(v))
+			if root != other {
+				parent[other] = root
+			}
+		}
+	}
+
+	changes := make(map[*component]*partitionChange)
+	members := make(map[*component][]*component)
+	var roots []*component
+	add := func(c *component) {
+		root := find(c)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		for _, member := range members[root] {
+			if member == c {
+				return
+			}
+		}
+		members[root] = append(members[root], c)
+	}
+	for _, owner := range owners {
+		add(owner)
+	}
+	for _, c := range fresh {
+		add(c)
+	}
+	for c := range parent {
+		add(c)
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].id < roots[j].id
+	})
+
+	result := make([]*partitionChange, 0, len(roots))
+	for _, root := range roots {
+		sort.Slice(members[root], func(i, j int) bool {
+			return members[root][i].id < members[root][j].id
+		})
+
+		change := &partitionChange{}
+		for _, member := range members[root] {
+			if change.target == nil || len(member.solver.variables) > len(change.target.solver.variables) {
+				change.target = member
+			}
+		}
+		for _, member := range members[root] {
+			if member != change.target && p.components[member] {
+				change.absorbed = append(change.absorbed, member)
+			}
+		}
+		changes[root] = change
+		result = append(result, change)
+	}
+	for i, constraint := range constraints {
+		change := changes[find(owners[i])]
+		change.constraints = append(change.constraints, constraint)
+	}
+
+	err := p.apply(result, func(change *partitionChange) error {
+		for _, absorbed := range change.absorbed {
+			if err := absorb(change.target.solver, absorbed.solver); err != nil {
+				return err
+			}
+		}
+		return change.target.solver.AddConstraints(change.constraints...)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range result {
+		for _, absorbed := range change.absorbed {
+			delete(p.components, absorbed)
+		}
+		p.components[change.target] = true
+		p.adopt(change.target)
+	}
+
+	return nil
+}
+
+// absorb re-adds all constraints and edit variables of the source to the target
+func absorb(target *Solver, source *Solver) error {
+	if err := target.AddConstraints(source.Constraints()...); err != nil {
+		return err
+	}
+
+	for _, edit := range source.EditVariables() {
+		if err := target.AddEditVariable(edit.Variable, float64(edit.Priority)); err != nil {
+			return err
+		}
+		target.SuggestValueForVariable(edit.Variable, edit.Value)
+	}
+
+	return nil
+}
+
+// adopt assigns all variables and constraints of the component's solver to it
+func (p *PartitionedSolver) adopt(c *component) {
+	for v := range c.solver.variables {
+		p.variables[v] = c
+	}
+	for _, constraint := range c.solver.Constraints() {
+		p.constraints[constraint] = c
+	}
+}
+
+// apply runs fn for all changes, each within a Transaction of its component. If any of them fails,
+// all are rolled back.
+func (p *PartitionedSolver) apply(changes []*partitionChange, fn func(*partitionChange) error) error {
+	for _, change := range changes {
+		change.tx = change.target.solver.Begin()
+	}
+
+	err := p.each(len(changes), func(i int) error {
+		return fn(changes[i])
+	})
+
+	for _, change := range changes {
+		if err != nil {
+			change.tx.Rollback()
+		} else {
+			change.tx.Commit()
+		}
+	}
+	return err
+}
+
+// each calls fn for all indices up to count, concurrently if the PartitionedSolver is parallel.
+// It returns the error of the lowest index which failed.
+func (p *PartitionedSolver) each(count int, fn func(int) error) error {
+	if !p.Parallel || count < 2 {
+		for i := 0; i < count; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PartitionedSolver) RemoveConstraint(constraint *Constraint) error {
+	return p.RemoveConstraints(constraint)
+}
+
+// RemoveConstraints removes all constraints atomically
+func (p *PartitionedSolver) RemoveConstraints(constraints ...*Constraint) error {
+	changes := make(map[*component]*partitionChange)
+	var result []*partitionChange
+	for _, constraint := range constraints {
+		c, ok := p.constraints[constraint]
+		if !ok {
+			return errors.New("Unknown constraint")
+		}
+
+		change, ok := changes[c]
+		if !ok {
+			change = &partitionChange{target: c}
+			changes[c] = change
+			result = append(result, change)
+		}
+		change.constraints = append(change.constraints, constraint)
+	}
+
+	err := p.apply(result, func(change *partitionChange) error {
+		return change.target.solver.RemoveConstraints(change.constraints...)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range result {
+		for _, constraint := range change.constraints {
+			delete(p.constraints, constraint)
+			p.forgetVariables(change.target, variablesOf(constraint))
+		}
+	}
+
+	return nil
+}
+
+// forgetVariables drops the variables the component does not know anymore, and the component itself once it is empty
+func (p *PartitionedSolver) forgetVariables(c *component, variables []*Variable) {
+	for _, v := range variables {
+		if _, ok := c.solver.variables[v]; !ok && p.variables[v] == c {
+			delete(p.variables, v)
+		}
+	}
+
+	if len(c.solver.constraints) == 0 {
+		delete(p.components, c)
+	}
+}
+
+func (p *PartitionedSolver) AddEditVariable(v *Variable, priority float64) error {
+	c, ok := p.variables[v]
+	if !ok {
+		c = p.newComponent()
+	}
+
+	if err := c.solver.AddEditVariable(v, priority); err != nil {
+		return err
+	}
+
+	p.components[c] = true
+	p.variables[v] = c
+	return nil
+}
+
+func (p *PartitionedSolver) SuggestValueForVariable(v *Variable, value float64) {
+	if c, ok := p.variables[v]; ok {
+		c.solver.SuggestValueForVariable(v, value)
+	}
+}
+
+// ValueOf returns the current value of the variable, see Solver.ValueOf
+func (p *PartitionedSolver) ValueOf(v *Variable) float64 {
+	if c, ok := p.variables[v]; ok {
+		return c.solver.ValueOf(v)
+	}
+	return 0
+}
+
+// FlushUpdates updates the variables of all components. The updates are ordered by component.
+func (p *PartitionedSolver) FlushUpdates() []*Update {
+	components := make([]*component, 0, len(p.components))
+	for c := range p.components {
+		components = append(components, c)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].id < components[j].id
+	})
+
+	updates := make([][]*Update, len(components))
+	p.each(len(components), func(i int) error {
+		updates[i] = components[i].solver.FlushUpdates()
+		return nil
+	})
+
+	result := make([]*Update, 0)
+	for _, batch := range updates {
+		result = append(result, batch...)
+	}
+	return result
+}
@@ -4,6 +4,14 @@
 
 package cassowary
 
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 type Priority int64
 
 const (
@@ -12,3 +20,117 @@ const (
 	PriorityMedium   Priority = 1000
 	PriorityWeak     Priority = 1
 )
+
+var priorityLevels = []struct {
+	priority Priority
+	name     string
+}{
+	{PriorityRequired, "required"},
+	{PriorityStrong, "strong"},
+	{PriorityMedium, "medium"},
+	{PriorityWeak, "weak"},
+}
+
+// NewPriority creates a priority composed of a strong, a medium and a weak part like Kiwi's strength::create.
+// Every part is multiplied by weight and clamped to [0, 1000]. The result is always weaker than PriorityRequired.
+func NewPriority(strong, medium, weak, weight float64) Priority {
+	clamp := func(value float64) float64 {
+		return math.Max(0.0, math.Min(1000.0, value*weight))
+	}
+
+	result := Priority(math.Round(clamp(strong)*float64(PriorityStrong) +
+		clamp(medium)*float64(PriorityMedium) +
+		clamp(weak)*float64(PriorityWeak)))
+
+	if result >= PriorityRequired {
+		return PriorityRequired - 1
+	}
+	return result
+}
+
+// String returns a textual representation of the priority, e.g. "strong", "medium:3" or "strong+10",
+// which can be read back by ParsePriority
+func (p Priority) String() string {
+	for _, level := range priorityLevels {
+		if p < level.priority {
+			continue
+		}
+
+		text := level.name
+		if factor := p / level.priority; factor != 1 {
+			text += ":" + strconv.FormatInt(int64(factor), 10)
+		}
+		if rest := p % level.priority; rest != 0 {
+			text += "+" + strconv.FormatInt(int64(rest), 10)
+		}
+		return text
+	}
+
+	return strconv.FormatInt(int64(p), 10)
+}
+
+// ParsePriority reads a priority from text. It accepts plain numbers as well as the names "required",
+// "strong", "medium" and "weak", optionally followed by a weight (e.g. "medium:3") and an offset in
+// units of PriorityWeak (e.g. "strong+10" or "medium-2").
+func ParsePriority(text string) (Priority, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		if value < 0 {
+			return 0, errors.Errorf("Negative priority %q", text)
+		}
+		return Priority(value), nil
+	}
+
+	for _, level := range priorityLevels {
+		if !strings.HasPrefix(text, level.name) {
+			continue
+		}
+
+		rest := text[len(level.name):]
+		weight := 1.0
+		var offset int64
+
+		if sign := strings.IndexAny(rest, "+-"); sign >= 0 {
+			value, err := strconv.ParseInt(rest[sign:], 10, 64)
+			if err != nil {
+				return 0, errors.Wrapf(err, "Bad priority offset in %q", text)
+			}
+			offset = value
+			rest = rest[:sign]
+		}
+
+		if strings.HasPrefix(rest, ":") {
+			value, err := strconv.ParseFloat(rest[1:], 64)
+			if err != nil {
+				return 0, errors.Wrapf(err, "Bad priority weight in %q", text)
+			}
+			weight = value
+		} else if rest != "" {
+			break
+		}
+
+		result := Priority(math.Round(float64(level.priority)*weight)) + Priority(offset)
+		if result < 0 {
+			return 0, errors.Errorf("Negative priority %q", text)
+		}
+		return result, nil
+	}
+
+	return 0, errors.Errorf("Unknown priority %q", text)
+}
+
+// MarshalText encodes the priority in the format of String
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority in any format accepted by ParsePriority
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
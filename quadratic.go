@@ -0,0 +1,83 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/pkg/errors"
+)
+
+// quadraticMode describes how the error of edit variables is approximated
+type quadraticMode struct {
+	step     float64
+	segments int
+}
+
+// SetQuadraticEdits makes the error of edit variables and stays added afterwards grow approximately quadratically
+// instead of linearly, so conflicting suggestions share the error instead of one of them winning completely.
+// The error is approximated by segments linear pieces of width step, the slope growing by the priority of
+// the edit variable or stay with every piece. Beyond segments*step the error keeps growing linearly. Passing less
+// than 2 segments restores linear errors.
+func (s *Solver) SetQuadraticEdits(step float64, segments int) error {
+	err := s.setQuadraticEdits(step, segments)
+	s.recorder.recordQuadratic(step, segments, err)
+	return err
+}
+
+func (s *Solver) setQuadraticEdits(step float64, segments int) error {
+	mode, err := newQuadraticMode(step, segments)
+	if err != nil {
+		return err
+	}
+
+	s.quadratic = mode
+	return nil
+}
+
+// newQuadraticMode validates a quadratic mode, nil stands for linear errors
+func newQuadraticMode(step float64, segments int) (*quadraticMode, error) {
+	if segments < 2 {
+		return nil, nil
+	}
+
+	if step <= 0 {
+		return nil, errors.New("Bad step")
+	}
+
+	return &quadraticMode{step: step, segments: segments}, nil
+}
+
+// quadraticMode returns the mode the bands of the edit variable or stay were added with, nil for linear errors
+func (info *editInfo) quadraticMode() *quadraticMode {
+	if len(info.bands) == 0 {
+		return nil
+	}
+
+	// the first band is `v - step <= 0`, relative to the suggested value
+	return &quadraticMode{step: -info.bands[0].expression.constant, segments: len(info.bands)/2 + 1}
+}
+
+// addBands adds the constraints approximating the quadratic error of an edit variable or stay. Every band
+// `-k*step <= v - value <= k*step` adds the priority to the slope of the error beyond k*step.
+func (s *Solver) addBands(v *Variable, info *editInfo, mode *quadraticMode) error {
+	if mode == nil {
+		return nil
+	}
+
+	for k := 1; k < mode.segments; k++ {
+		width := float64(k) * mode.step
+		for _, band := range []*Constraint{
+			NewConstraint(NewExpression([]*Term{NewTerm(v, 1.0)}, -width), LessThanOrEqualTo),
+			NewConstraint(NewExpression([]*Term{NewTerm(v, 1.0)}, width), GreaterThanOrEqualTo),
+		} {
+			band.Priority = info.constraint.Priority
+			if err := s.addConstraint(band); err != nil {
+				return err
+			}
+			info.bands = append(info.bands, band)
+		}
+	}
+
+	return nil
+}
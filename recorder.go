@@ -0,0 +1,614 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+const (
+	opInit            = "init"
+	opAdd             = "add"
+	opAddAll          = "add_all"
+	opRemove          = "remove"
+	opRemoveAll       = "remove_all"
+	opPriority        = "priority"
+	opConstant        = "constant"
+	opEdit            = "edit"
+	opSuggest         = "suggest"
+	opFlush           = "flush"
+	opRejectRedundant = "reject_redundant"
+	opBegin           = "begin"
+	opCommit          = "commit"
+	opRollback        = "rollback"
+	opSnapshot        = "snapshot"
+	opRestore         = "restore"
+	opRemoveVariable  = "remove_variable"
+	opObjective       = "objective"
+	opRemoveObjective = "remove_objective"
+	opQuadratic       = "quadratic"
+	opRemoveEdit      = "remove_edit"
+	opFlushIntegral   = "flush_integral"
+	opStay            = "stay"
+	opRemoveStay      = "remove_stay"
+)
+
+// logEntry is a single operation within an operation log. Variables and constraints are referenced by ids,
+// every entry declares the variables it uses for the first time.
+type logEntry struct {
+	Op          string           `json:"op"`
+	System      *jsonSystem      `json:"system,omitempty"`
+	Variables   []jsonVariable   `json:"variables,omitempty"`
+	Constraints []int            `json:"constraints,omitempty"`
+	Definitions []jsonConstraint `json:"definitions,omitempty"`
+	Objective   *jsonObjective   `json:"objective,omitempty"`
+	Variable    *int             `json:"variable,omitempty"`
+	Priority    *Priority        `json:"priority,omitempty"`
+	Value       *float64         `json:"value,omitempty"`
+	Flag        *bool            `json:"flag,omitempty"`
+	Segments    *int             `json:"segments,omitempty"`
+	Limit       *int             `json:"limit,omitempty"`
+	Handle      *int             `json:"handle,omitempty"`
+	Values      []jsonValue      `json:"values,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+type jsonValue struct {
+	Variable int     `json:"variable"`
+	Value    float64 `json:"value"`
+}
+
+// Recorder writes every operation applied to a Solver together with its arguments and outcome to a log
+// of JSON objects, one per line. Replay executes such a log again. A Recorder must only be attached to a
+// single Solver.
+type Recorder struct {
+	encoder     *json.Encoder
+	variables   *jsonVariables
+	constraints map[*Constraint]int
+	handles     map[interface{}]int
+	err         error
+}
+
+// NewRecorder creates a Recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	return &Recorder{
+		encoder:     encoder,
+		variables:   newJSONVariables(),
+		constraints: make(map[*Constraint]int),
+		handles:     make(map[interface{}]int),
+	}
+}
+
+// Err returns the first error which occurred while writing the log
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+// SetRecorder attaches a Recorder to the Solver, which immediately records the current state of the
+// Solver and afterwards every operation. Passing nil stops recording.
+func (s *Solver) SetRecorder(r *Recorder) {
+	s.recorder = r
+	if r == nil {
+		return
+	}
+
+	system, constraints := s.encodeJSONSystem(r.variables)
+	for _, constraint := range constraints {
+		r.constraintID(constraint)
+	}
+	for _, objective := range s.orderedObjectives() {
+		r.handleID(objective)
+	}
+	flag := s.rejectRedundant
+	r.write(&logEntry{Op: opInit, System: system, Flag: &flag}, nil)
+}
+
+func (r *Recorder) write(entry *logEntry, err error) {
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if r.err == nil {
+		r.err = r.encoder.Encode(entry)
+	}
+}
+
+func (r *Recorder) constraintID(c *Constraint) int {
+	id, ok := r.constraints[c]
+	if !ok {
+		id = len(r.constraints)
+		r.constraints[c] = id
+	}
+	return id
+}
+
+func (r *Recorder) variableID(entry *logEntry, v *Variable) int {
+	known := len(r.variables.variables)
+	id := r.variables.id(v)
+	entry.Variables = append(entry.Variables, r.variables.variables[known:]...)
+	return id
+}
+
+func (r *Recorder) recordConstraints(op string, constraints []*Constraint, err error) {
+	if r == nil {
+		return
+	}
+
+	entry := &logEntry{Op: op}
+	known := len(r.variables.variables)
+	for _, constraint := range constraints {
+		entry.Constraints = append(entry.Constraints, r.constraintID(constraint))
+		if op == opAdd || op == opAddAll {
+			entry.Definitions = append(entry.Definitions, r.variables.constraint(constraint))
+		}
+	}
+	entry.Variables = r.variables.variables[known:]
+
+	r.write(entry, err)
+}
+
+func (r *Recorder) recordPriority(c *Constraint, priority Priority, err error) {
+	if r == nil {
+		return
+	}
+
+	id := r.constraintID(c)
+	r.write(&logEntry{Op: opPriority, Constraints: []int{id}, Priority: &priority}, err)
+}
+
+func (r *Recorder) recordConstant(c *Constraint, constant float64, err error) {
+	if r == nil {
+		return
+	}
+
+	id := r.constraintID(c)
+	r.write(&logEntry{Op: opConstant, Constraints: []int{id}, Value: &constant}, err)
+}
+
+func (r *Recorder) recordEdit(v *Variable, priority Priority, err error) {
+	if r == nil {
+		return
+	}
+
+	entry := &logEntry{Op: opEdit, Priority: &priority}
+	id := r.variableID(entry, v)
+	entry.Variable = &id
+	r.write(entry, err)
+}
+
+// recordStay records adding a stay, or removing it if op is opRemoveStay
+func (r *Recorder) recordStay(op string, v *Variable, priority Priority, err error) {
+	if r == nil {
+		return
+	}
+
+	entry := &logEntry{Op: op}
+	if op == opStay {
+		entry.Priority = &priority
+	}
+	id := r.variableID(entry, v)
+	entry.Variable = &id
+	r.write(entry, err)
+}
+
+func (r *Recorder) recordSuggestion(v *Variable, value float64) {
+	if r == nil {
+		return
+	}
+
+	entry := &logEntry{Op: opSuggest, Value: &value}
+	id := r.variableID(entry, v)
+	entry.Variable = &id
+	r.write(entry, nil)
+}
+
+// recordVariable records an operation whose only argument is the variable
+func (r *Recorder) recordVariable(op string, v *Variable, err error) {
+	if r == nil {
+		return
+	}
+
+	entry := &logEntry{Op: op}
+	id := r.variableID(entry, v)
+	entry.Variable = &id
+	r.write(entry, err)
+}
+
+func (r *Recorder) recordFlush(s *Solver) {
+	if r == nil {
+		return
+	}
+
+	r.recordValues(&logEntry{Op: opFlush}, s)
+}
+
+func (r *Recorder) recordIntegralFlush(s *Solver, limit int) {
+	if r == nil {
+		return
+	}
+
+	r.recordValues(&logEntry{Op: opFlushIntegral, Limit: &limit}, s)
+}
+
+// recordValues writes the entry together with the flushed values of all variables
+func (r *Recorder) recordValues(entry *logEntry, s *Solver) {
+	entry.Values = make([]jsonValue, 0, len(s.variables))
+	known := len(r.variables.variables)
+	for v := range s.variables {
+		entry.Values = append(entry.Values, jsonValue{Variable: r.variables.id(v), Value: v.Value})
+	}
+	entry.Variables = r.variables.variables[known:]
+	sort.Slice(entry.Values, func(i, j int) bool {
+		return entry.Values[i].Variable < entry.Values[j].Variable
+	})
+
+	r.write(entry, nil)
+}
+
+func (r *Recorder) recordQuadratic(step float64, segments int, err error) {
+	if r == nil {
+		return
+	}
+
+	r.write(&logEntry{Op: opQuadratic, Value: &step, Segments: &segments}, err)
+}
+
+func (r *Recorder) recordRejectRedundant(reject bool) {
+	if r == nil {
+		return
+	}
+
+	r.write(&logEntry{Op: opRejectRedundant, Flag: &reject}, nil)
+}
+
+func (r *Recorder) handleID(handle interface{}) int {
+	id, ok := r.handles[handle]
+	if !ok {
+		id = len(r.handles)
+		r.handles[handle] = id
+	}
+	return id
+}
+
+// recordHandle records operations on transactions, snapshots and objectives, which are identified by handles
+func (r *Recorder) recordHandle(op string, handle interface{}, err error) {
+	if r == nil {
+		return
+	}
+
+	id := r.handleID(handle)
+	r.write(&logEntry{Op: op, Handle: &id}, err)
+}
+
+func (r *Recorder) recordObjective(objective *Objective, err error) {
+	if r == nil {
+		return
+	}
+
+	id := r.handleID(objective)
+	known := len(r.variables.variables)
+	definition := r.variables.objective(objective)
+	r.write(&logEntry{
+		Op:        opObjective,
+		Handle:    &id,
+		Objective: &definition,
+		Variables: r.variables.variables[known:],
+	}, err)
+}
+
+// ReplayDifference describes an operation whose outcome differed between recording and replay
+type ReplayDifference struct {
+	// Index is the position of the operation within the log, starting with 0 for the initial state
+	Index int
+
+	// Op is the name of the operation
+	Op string
+
+	// Variable is the variable whose value differs after a flush, it is nil if the errors differ
+	Variable *Variable
+
+	RecordedValue float64
+	ReplayedValue float64
+
+	RecordedError string
+	ReplayedError string
+}
+
+// ReplayResult is the outcome of a replay
+type ReplayResult struct {
+	// Solver is the Solver the log was replayed on
+	Solver *Solver
+
+	// Variables contains the variables of the log ordered by their ids
+	Variables []*Variable
+
+	// Differences contains every deviation of the replay from the recorded log
+	Differences []*ReplayDifference
+}
+
+// Replay executes an operation log written by a Recorder against a fresh Solver and reports every
+// error and flushed value which differs from the recorded one.
+func Replay(log io.Reader) (*ReplayResult, error) {
+	decoder := json.NewDecoder(log)
+
+	entry := &logEntry{}
+	if err := decoder.Decode(entry); err != nil {
+		return nil, errors.Wrap(err, "Could not read initial state")
+	}
+	if entry.Op != opInit || entry.System == nil {
+		return nil, errors.New("Log does not start with the initial state")
+	}
+
+	s, variables, constraints, err := decodeJSONSystem(entry.System)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not restore initial state")
+	}
+	if entry.Flag != nil {
+		s.rejectRedundant = *entry.Flag
+	}
+
+	replay := &replayer{
+		solver:       s,
+		result:       &ReplayResult{Solver: s, Variables: variables, Differences: make([]*ReplayDifference, 0)},
+		constraints:  constraints,
+		transactions: make(map[int]*Transaction),
+		snapshots:    make(map[int]*Snapshot),
+		objectives:   make(map[int]*Objective),
+	}
+	for i, objective := range s.orderedObjectives() {
+		replay.objectives[i] = objective
+	}
+
+	for index := 1; ; index++ {
+		entry := &logEntry{}
+		if err := decoder.Decode(entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Could not read operation %d", index)
+		}
+
+		if err := replay.apply(index, entry); err != nil {
+			return nil, errors.Wrapf(err, "Could not replay operation %d", index)
+		}
+	}
+
+	return replay.result, nil
+}
+
+type replayer struct {
+	solver       *Solver
+	result       *ReplayResult
+	constraints  []*Constraint
+	transactions map[int]*Transaction
+	snapshots    map[int]*Snapshot
+	objectives   map[int]*Objective
+}
+
+func (r *replayer) constraint(id int) (*Constraint, error) {
+	if id < 0 || id >= len(r.constraints) || r.constraints[id] == nil {
+		return nil, errors.Errorf("Unknown constraint id %d", id)
+	}
+	return r.constraints[id], nil
+}
+
+// defineConstraint returns the constraint with the given id, which is created or updated
+// according to the definition
+func (r *replayer) defineConstraint(id int, definition jsonConstraint) (*Constraint, error) {
+	if id < 0 || id > len(r.constraints) {
+		return nil, errors.Errorf("Unexpected constraint id %d", id)
+	}
+
+	if id < len(r.constraints) && r.constraints[id] != nil {
+		constraint := r.constraints[id]
+		constraint.Priority = definition.Priority
+		constraint.expression.constant = definition.Constant
+		return constraint, nil
+	}
+
+	constraint, err := decodeJSONConstraint(r.result.Variables, definition)
+	if err != nil {
+		return nil, err
+	}
+	if id == len(r.constraints) {
+		r.constraints = append(r.constraints, constraint)
+	} else {
+		r.constraints[id] = constraint
+	}
+	return constraint, nil
+}
+
+func (r *replayer) variable(entry *logEntry) (*Variable, error) {
+	if entry.Variable == nil {
+		return nil, errors.New("Missing variable")
+	}
+	return variableForID(r.result.Variables, *entry.Variable)
+}
+
+func (r *replayer) apply(index int, entry *logEntry) error {
+	for _, v := range entry.Variables {
+		var err error
+		if r.result.Variables, err = declareJSONVariable(r.result.Variables, v); err != nil {
+			return err
+		}
+	}
+
+	s := r.solver
+	var err error
+
+	switch entry.Op {
+	case opAdd, opAddAll:
+		if len(entry.Constraints) != len(entry.Definitions) {
+			return errors.New("Missing constraint definitions")
+		}
+		constraints := make([]*Constraint, len(entry.Constraints))
+		for i, id := range entry.Constraints {
+			if constraints[i], err = r.defineConstraint(id, entry.Definitions[i]); err != nil {
+				return err
+			}
+		}
+		if entry.Op == opAdd {
+			err = s.AddConstraint(constraints[0])
+		} else {
+			err = s.AddConstraints(constraints...)
+		}
+	case opRemove, opRemoveAll, opPriority, opConstant:
+		constraints := make([]*Constraint, len(entry.Constraints))
+		for i, id := range entry.Constraints {
+			var lookupErr error
+			if constraints[i], lookupErr = r.constraint(id); lookupErr != nil {
+				return lookupErr
+			}
+		}
+		if len(constraints) == 0 {
+			return errors.New("Missing constraint")
+		}
+		switch {
+		case entry.Op == opRemove:
+			err = s.RemoveConstraint(constraints[0])
+		case entry.Op == opRemoveAll:
+			err = s.RemoveConstraints(constraints...)
+		case entry.Op == opPriority && entry.Priority != nil:
+			err = s.SetConstraintPriority(constraints[0], *entry.Priority)
+		case entry.Op == opConstant && entry.Value != nil:
+			err = s.UpdateConstraintConstant(constraints[0], *entry.Value)
+		default:
+			return errors.New("Missing argument")
+		}
+	case opEdit:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil || entry.Priority == nil {
+			return errors.New("Missing edit variable")
+		}
+		err = s.AddEditVariable(v, float64(*entry.Priority))
+	case opStay:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil || entry.Priority == nil {
+			return errors.New("Missing stay")
+		}
+		err = s.AddStay(v, *entry.Priority)
+	case opRemoveStay:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		err = s.RemoveStay(v)
+	case opSuggest:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil || entry.Value == nil {
+			return errors.New("Missing suggestion")
+		}
+		s.SuggestValueForVariable(v, *entry.Value)
+	case opRemoveVariable:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		err = s.RemoveVariable(v)
+	case opRemoveEdit:
+		v, lookupErr := r.variable(entry)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		err = s.RemoveEditVariable(v)
+	case opFlush, opFlushIntegral:
+		if entry.Op == opFlush {
+			s.FlushUpdates()
+		} else if entry.Limit != nil {
+			s.FlushIntegralUpdates(*entry.Limit)
+		} else {
+			return errors.New("Missing limit")
+		}
+		for _, value := range entry.Values {
+			v, lookupErr := variableForID(r.result.Variables, value.Variable)
+			if lookupErr != nil {
+				return lookupErr
+			}
+			if !internal.IsNearZero(v.Value - value.Value) {
+				r.result.Differences = append(r.result.Differences, &ReplayDifference{
+					Index:         index,
+					Op:            entry.Op,
+					Variable:      v,
+					RecordedValue: value.Value,
+					ReplayedValue: v.Value,
+				})
+			}
+		}
+	case opRejectRedundant:
+		if entry.Flag == nil {
+			return errors.New("Missing flag")
+		}
+		s.SetRejectRedundant(*entry.Flag)
+	case opQuadratic:
+		if entry.Value == nil || entry.Segments == nil {
+			return errors.New("Missing quadratic mode")
+		}
+		err = s.SetQuadraticEdits(*entry.Value, *entry.Segments)
+	case opObjective:
+		if entry.Handle == nil || entry.Objective == nil {
+			return errors.New("Missing objective")
+		}
+		objective, decodeErr := decodeJSONObjective(r.result.Variables, *entry.Objective)
+		if decodeErr != nil {
+			return decodeErr
+		}
+		r.objectives[*entry.Handle] = objective
+		_, err = s.AddObjective(objective)
+	case opBegin, opCommit, opRollback, opSnapshot, opRestore, opRemoveObjective:
+		if entry.Handle == nil {
+			return errors.New("Missing handle")
+		}
+		err = r.applyHandle(entry.Op, *entry.Handle)
+	default:
+		return errors.Errorf("Unknown operation %q", entry.Op)
+	}
+
+	replayed := ""
+	if err != nil {
+		replayed = err.Error()
+	}
+	if replayed != entry.Error {
+		r.result.Differences = append(r.result.Differences, &ReplayDifference{
+			Index:         index,
+			Op:            entry.Op,
+			RecordedError: entry.Error,
+			ReplayedError: replayed,
+		})
+	}
+
+	return nil
+}
+
+func (r *replayer) applyHandle(op string, handle int) error {
+	s := r.solver
+
+	switch op {
+	case opBegin:
+		r.transactions[handle] = s.Begin()
+	case opSnapshot:
+		r.snapshots[handle] = s.Snapshot()
+	case opRestore:
+		return s.Restore(r.snapshots[handle])
+	case opRemoveObjective:
+		return s.RemoveObjective(r.objectives[handle])
+	default:
+		tx, ok := r.transactions[handle]
+		if !ok {
+			return errors.New("Unknown transaction")
+		}
+		if op == opCommit {
+			return tx.Commit()
+		}
+		return tx.Rollback()
+	}
+
+	return nil
+}
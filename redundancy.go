@@ -0,0 +1,89 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/monkey-works/cassowary/internal"
+)
+
+// Redundancy describes a required constraint which is implied by other required constraints
+// already known to the Solver. Such a constraint does not change the solution at all.
+type Redundancy struct {
+	// Constraint is the redundant constraint
+	Constraint *Constraint
+
+	// ImpliedBy contains the required constraints the redundant constraint follows from
+	ImpliedBy []*Constraint
+}
+
+// RedundancyError is returned by AddConstraint for redundant constraints if the Solver
+// rejects them (see SetRejectRedundant)
+type RedundancyError struct {
+	Redundancy *Redundancy
+}
+
+func (e *RedundancyError) Error() string {
+	return "Redundant constraint"
+}
+
+// SetRejectRedundant controls whether redundant required constraints are rejected by AddConstraint
+// with a RedundancyError instead of being added and reported by Redundancies
+func (s *Solver) SetRejectRedundant(reject bool) {
+	s.rejectRedundant = reject
+	s.recorder.recordRejectRedundant(reject)
+}
+
+// Redundancies returns the redundant constraints currently added to the Solver in the order they were added
+func (s *Solver) Redundancies() []*Redundancy {
+	result := make([]*Redundancy, len(s.redundancies))
+	copy(result, s.redundancies)
+	return result
+}
+
+// redundancyForRow collects the constraints whose dummy markers make up the given row. The row of
+// a redundant constraint contains nothing but the dummy markers of the required equalities it
+// follows from (and its own marker).
+func (s *Solver) redundancyForRow(constraint *Constraint, row *internal.Row, tag *internal.Tag) *Redundancy {
+	result := &Redundancy{
+		Constraint: constraint,
+		ImpliedBy:  make([]*Constraint, 0),
+	}
+
+	for other, otherTag := range s.constraints {
+		if otherTag.Marker == tag.Marker {
+			continue
+		}
+		if _, ok := row.Cells[otherTag.Marker]; ok {
+			result.ImpliedBy = append(result.ImpliedBy, other)
+		}
+	}
+	s.sortConstraints(result.ImpliedBy)
+
+	return result
+}
+
+// forgetRedundancies drops all redundancy reports involving the given constraint. Once one of the
+// implying constraints is gone the remaining constraint is not known to be redundant anymore.
+func (s *Solver) forgetRedundancies(constraint *Constraint) {
+	kept := s.redundancies[:0]
+
+outer:
+	for _, redundancy := range s.redundancies {
+		if redundancy.Constraint == constraint {
+			continue
+		}
+		for _, other := range redundancy.ImpliedBy {
+			if other == constraint {
+				continue outer
+			}
+		}
+		kept = append(kept, redundancy)
+	}
+
+	for i := len(kept); i < len(s.redundancies); i++ {
+		s.redundancies[i] = nil
+	}
+	s.redundancies = kept
+}
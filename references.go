@@ -0,0 +1,188 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// RemoveVariable removes all constraints and objectives mentioning the variable, including its edit
+// variable and stay, and with them the variable itself. Variables are also removed automatically once the last
+// constraint or objective mentioning them is removed.
+func (s *Solver) RemoveVariable(v *Variable) error {
+	err := s.removeVariable(v)
+	s.recorder.recordVariable(opRemoveVariable, v, err)
+	return err
+}
+
+func (s *Solver) removeVariable(v *Variable) error {
+	if _, ok := s.variables[v]; !ok {
+		return errors.New("Unknown variable")
+	}
+
+	mentions := func(expression *Expression) bool {
+		for _, other := range variablesOfExpression(expression) {
+			if other == v {
+				return true
+			}
+		}
+		return false
+	}
+
+	return s.atomically(func() error {
+		// the edit variable and stay are removed first, so their constraints are not removed on their own below
+		if _, ok := s.edits[v]; ok {
+			if err := s.removeEditVariable(v); err != nil {
+				return err
+			}
+		}
+		if _, ok := s.stays[v]; ok {
+			if err := s.removeStay(v); err != nil {
+				return err
+			}
+		}
+
+		for _, constraint := range s.orderedConstraints() {
+			if !mentions(constraint.expression) {
+				continue
+			}
+			if err := s.removeConstraint(constraint); err != nil {
+				return err
+			}
+		}
+		for _, objective := range s.orderedObjectives() {
+			if !mentions(objective.expression) {
+				continue
+			}
+			if err := s.removeObjective(objective); err != nil {
+				return err
+			}
+		}
+
+		s.dropVariable(v)
+		return nil
+	})
+}
+
+// variablesOf returns the distinct variables the tableau row of the constraint is built from
+func variablesOf(c *Constraint) []*Variable {
+	return variablesOfExpression(c.expression)
+}
+
+func variablesOfExpression(expression *Expression) []*Variable {
+	var result []*Variable
+	seen := make(map[*Variable]bool)
+
+	for _, term := range FromExpression(expression).terms {
+		if internal.IsNearZero(term.coefficient) || seen[term.variable] {
+			continue
+		}
+		seen[term.variable] = true
+		result = append(result, term.variable)
+	}
+
+	return result
+}
+
+func (s *Solver) retainVariables(c *Constraint) {
+	s.retain(variablesOf(c))
+}
+
+// releaseVariables drops every variable of the constraint which is not mentioned by another constraint anymore
+func (s *Solver) releaseVariables(c *Constraint) {
+	s.release(variablesOf(c))
+}
+
+func (s *Solver) retain(variables []*Variable) {
+	s.logReferences(variables)
+	for _, v := range variables {
+		s.references[v]++
+	}
+}
+
+func (s *Solver) release(variables []*Variable) {
+	s.logReferences(variables)
+	for _, v := range variables {
+		s.references[v]--
+		if s.references[v] <= 0 {
+			s.dropVariable(v)
+		}
+	}
+}
+
+// logReferences logs how to restore the reference counts of the variables
+func (s *Solver) logReferences(variables []*Variable) {
+	if !s.logsUndo() {
+		return
+	}
+
+	counts := make(map[*Variable]int, len(variables))
+	for _, v := range variables {
+		if count, ok := s.references[v]; ok {
+			counts[v] = count
+		}
+	}
+	s.logUndo(func() {
+		for _, v := range variables {
+			if count, ok := counts[v]; ok {
+				s.references[v] = count
+			} else {
+				delete(s.references, v)
+			}
+		}
+	})
+}
+
+// countReferences rebuilds the reference counts from the constraints and objectives of the Solver
+func (s *Solver) countReferences() {
+	s.references = make(map[*Variable]int, len(s.variables))
+	count := func(variables []*Variable) {
+		for _, v := range variables {
+			s.references[v]++
+		}
+	}
+	for constraint := range s.constraints {
+		count(variablesOf(constraint))
+	}
+	for objective := range s.goals {
+		count(variablesOfExpression(objective.expression))
+	}
+}
+
+func (s *Solver) dropVariable(v *Variable) {
+	symbol, ok := s.variables[v]
+	if !ok {
+		delete(s.references, v)
+		return
+	}
+
+	order := s.variableOrder[v]
+	count, counted := s.references[v]
+	s.logUndo(func() {
+		s.variables[v] = symbol
+		s.variableOrder[v] = order
+		if counted {
+			s.references[v] = count
+		}
+	})
+	delete(s.variables, v)
+	delete(s.variableOrder, v)
+	delete(s.references, v)
+
+	// without any constraint the symbol is not part of the tableau anymore, except for traces
+	// left behind by rounding errors
+	s.saveBasis(symbol)
+	s.saveCellsContaining(symbol)
+	delete(s.rows, symbol)
+	for _, row := range s.rows {
+		delete(row.Cells, symbol)
+	}
+	delete(s.objective.Cells, symbol)
+	delete(s.artificial.Cells, symbol)
+	for _, level := range s.levels {
+		delete(level.Cells, symbol)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"math"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// Sensitivity describes how the objective of a Solver depends on the constant of a constraint
+type Sensitivity struct {
+	// ShadowPrice is the change of the objective, i.e. the total weighted error plus all objectives,
+	// per unit the constant of the constraint increases
+	ShadowPrice float64
+
+	// Lower and Upper limit the constant of the constraint. Within these limits the current basis
+	// stays optimal and the shadow price applies. Missing limits are -Inf and +Inf.
+	Lower float64
+	Upper float64
+}
+
+// Sensitivity returns how the objective changes with the constant of the constraint. For a constraint like
+// `width >= minWidth` the constant is `-minWidth`. It is not available for hierarchical solvers, as their
+// objectives cannot be expressed by a single number.
+func (s *Solver) Sensitivity(constraint *Constraint) (*Sensitivity, error) {
+	if s.hierarchical {
+		return nil, errors.New("Sensitivity is not available for hierarchical solvers")
+	}
+
+	tag, ok := s.constraints[constraint]
+	if !ok {
+		return nil, errors.New("Unknown constraint")
+	}
+
+	markerCoefficient, otherCoefficient := markerCoefficients(constraint)
+	changes := s.constantShiftEffects(tag, markerCoefficient, otherCoefficient)
+
+	weights := make(map[*internal.Symbol]float64)
+	for priority, terms := range s.objectiveTerms() {
+		for symbol, coefficient := range terms {
+			weights[symbol] += float64(priority) * coefficient
+		}
+	}
+
+	result := &Sensitivity{}
+	lower, upper := math.Inf(-1), math.Inf(1)
+	for symbol, change := range changes {
+		result.ShadowPrice += weights[symbol] * change
+
+		if symbol.Type == internal.External || internal.IsNearZero(change) {
+			continue
+		}
+		if symbol.Type == internal.Dummy {
+			lower, upper = 0, 0
+			continue
+		}
+
+		// restricted symbols have to stay positive: constant + change*delta >= 0
+		limit := -s.rows[symbol].Constant / change
+		if change > 0 {
+			lower = math.Max(lower, limit)
+		} else {
+			upper = math.Min(upper, limit)
+		}
+	}
+
+	result.Lower = constraint.expression.constant + lower
+	result.Upper = constraint.expression.constant + upper
+	return result, nil
+}
+
+// constantShiftEffects returns the change of every basic symbol per unit the constant of the constraint row
+// identified by tag increases. It mirrors the three cases of shiftConstant.
+func (s *Solver) constantShiftEffects(tag *internal.Tag, markerCoefficient, otherCoefficient float64) map[*internal.Symbol]float64 {
+	if _, ok := s.rows[tag.Marker]; ok {
+		return map[*internal.Symbol]float64{tag.Marker: -1.0 / markerCoefficient}
+	}
+
+	if otherCoefficient != 0.0 {
+		if _, ok := s.rows[tag.Other]; ok {
+			return map[*internal.Symbol]float64{tag.Other: -1.0 / otherCoefficient}
+		}
+	}
+
+	result := make(map[*internal.Symbol]float64)
+	for symbol, row := range s.rows {
+		if coefficient := row.CoefficientForSymbol(tag.Marker); coefficient != 0.0 {
+			result[symbol] = coefficient / markerCoefficient
+		}
+	}
+	return result
+}
+
+// objectiveTerms returns the terms the objectives of the Solver consist of, grouped by priority and
+// before any substitution: the error symbols of soft constraints and the external symbols of objectives
+// added by Minimize and Maximize. The coefficients are not weighted by the priority.
+func (s *Solver) objectiveTerms() map[Priority]map[*internal.Symbol]float64 {
+	result := make(map[Priority]map[*internal.Symbol]float64)
+	terms := func(priority Priority) map[*internal.Symbol]float64 {
+		if _, ok := result[priority]; !ok {
+			result[priority] = make(map[*internal.Symbol]float64)
+		}
+		return result[priority]
+	}
+
+	for constraint, tag := range s.constraints {
+		if tag.Marker.Type == internal.Error {
+			terms(constraint.Priority)[tag.Marker] += 1.0
+		}
+		if tag.Other.Type == internal.Error {
+			terms(constraint.Priority)[tag.Other] += 1.0
+		}
+	}
+
+	for objective := range s.goals {
+		for _, term := range FromExpression(objective.expression).terms {
+			if symbol, ok := s.variables[term.variable]; ok {
+				terms(objective.priority)[symbol] += objective.sign() * term.coefficient
+			}
+		}
+	}
+
+	return result
+}
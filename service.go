@@ -0,0 +1,176 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/pkg/errors"
+)
+
+type commandKind int
+
+const (
+	commandAdd commandKind = iota
+	commandRemove
+	commandRemoveVariable
+	commandEdit
+	commandSuggest
+)
+
+// Command is an operation sent to a Service
+type Command struct {
+	kind        commandKind
+	constraints []*Constraint
+	variable    *Variable
+	value       float64
+	result      chan<- error
+}
+
+// NewAddCommand creates a Command adding all constraints atomically, see Solver.AddConstraints
+func NewAddCommand(constraints ...*Constraint) *Command {
+	return &Command{kind: commandAdd, constraints: constraints}
+}
+
+// NewRemoveCommand creates a Command removing all constraints atomically, see Solver.RemoveConstraints
+func NewRemoveCommand(constraints ...*Constraint) *Command {
+	return &Command{kind: commandRemove, constraints: constraints}
+}
+
+// NewRemoveVariableCommand creates a Command removing the variable, see Solver.RemoveVariable
+func NewRemoveVariableCommand(v *Variable) *Command {
+	return &Command{kind: commandRemoveVariable, variable: v}
+}
+
+// NewEditCommand creates a Command adding an edit variable, see Solver.AddEditVariable
+func NewEditCommand(v *Variable, priority float64) *Command {
+	return &Command{kind: commandEdit, variable: v, value: priority}
+}
+
+// NewSuggestCommand creates a Command suggesting a value for an edit variable. Suggestions for the
+// same variable which are queued up behind each other are coalesced, only the last value is applied.
+func NewSuggestCommand(v *Variable, value float64) *Command {
+	return &Command{kind: commandSuggest, variable: v, value: value}
+}
+
+// WithResult makes the Service send the outcome of the Command to result. The Service blocks until
+// the result is received, so result should be buffered.
+func (c *Command) WithResult(result chan<- error) *Command {
+	c.result = result
+	return c
+}
+
+func (c *Command) reply(err error) {
+	if c.result != nil {
+		c.result <- err
+	}
+}
+
+// Service owns a Solver within its own goroutine. It applies the Commands sent to it in order and
+// publishes the resulting updates in batches: all commands queued up at the same time are applied
+// together, followed by a single FlushUpdates.
+//
+// A batch is only published once it has been received from Updates. Until then no further commands are
+// accepted, so slow consumers slow down the producers of commands instead of accumulating updates.
+type Service struct {
+	solver   *Solver
+	commands chan *Command
+	updates  chan []*Update
+
+	// suggestions collects the coalesced suggestions in the order they were sent first
+	suggestions []*Command
+}
+
+// NewService starts a Service owning the Solver, which must not be used directly afterwards. If solver is
+// nil, a new Solver is created. buffer is the number of commands which can be queued up without blocking.
+func NewService(solver *Solver, buffer int) *Service {
+	if solver == nil {
+		solver = NewSolver()
+	}
+
+	service := &Service{
+		solver:   solver,
+		commands: make(chan *Command, buffer),
+		updates:  make(chan []*Update),
+	}
+	go service.run()
+	return service
+}
+
+// Commands returns the channel accepting commands for the Service
+func (s *Service) Commands() chan<- *Command {
+	return s.commands
+}
+
+// Updates returns the channel publishing the updates of every batch of commands. It is closed once the
+// Service has been closed and all commands have been applied.
+func (s *Service) Updates() <-chan []*Update {
+	return s.updates
+}
+
+// Close stops accepting commands. Commands already sent are still applied, so Updates has to be
+// drained until it is closed. No commands must be sent after Close.
+func (s *Service) Close() {
+	close(s.commands)
+}
+
+func (s *Service) run() {
+	defer close(s.updates)
+
+	for command := range s.commands {
+		s.apply(command)
+		for queued := len(s.commands); queued > 0; queued-- {
+			next, ok := <-s.commands
+			if !ok {
+				break
+			}
+			s.apply(next)
+		}
+		s.applySuggestions()
+
+		s.updates <- s.solver.FlushUpdates()
+	}
+}
+
+func (s *Service) apply(command *Command) {
+	if command.kind == commandSuggest {
+		for i, pending := range s.suggestions {
+			if pending.variable == command.variable {
+				// the superseded suggestion is reported as applied, its effect is covered by the new one
+				pending.reply(nil)
+				s.suggestions[i] = command
+				return
+			}
+		}
+		s.suggestions = append(s.suggestions, command)
+		return
+	}
+
+	// pending suggestions are applied first to keep the order of commands observable
+	s.applySuggestions()
+
+	var err error
+	switch command.kind {
+	case commandAdd:
+		err = s.solver.AddConstraints(command.constraints...)
+	case commandRemove:
+		err = s.solver.RemoveConstraints(command.constraints...)
+	case commandRemoveVariable:
+		err = s.solver.RemoveVariable(command.variable)
+	case commandEdit:
+		err = s.solver.AddEditVariable(command.variable, command.value)
+	}
+	command.reply(err)
+}
+
+func (s *Service) applySuggestions() {
+	for _, command := range s.suggestions {
+		if _, ok := s.solver.edits[command.variable]; !ok {
+			command.reply(errors.New("Unknown edit variable"))
+			continue
+		}
+		s.solver.SuggestValueForVariable(command.variable, command.value)
+		command.reply(nil)
+	}
+	s.suggestions = s.suggestions[:0]
+}
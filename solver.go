@@ -6,6 +6,7 @@ package cassowary
 
 import (
 	"container/list"
+	"sort"
 
 	"math"
 
@@ -17,24 +18,54 @@ type editInfo struct {
 	tag        *internal.Tag
 	constraint *Constraint
 	constant   float64
+
+	// bands approximate a quadratic error, their constants are relative to the suggested value
+	bands []*Constraint
 }
 
 type Solver struct {
 	constraints    map[*Constraint]*internal.Tag
+	order          map[*Constraint]uint64
+	nextOrder      uint64
 	rows           map[*internal.Symbol]*internal.Row
 	variables      map[*Variable]*internal.Symbol
+	variableOrder  map[*Variable]uint64
+	references     map[*Variable]int
 	edits          map[*Variable]*editInfo
+	stays          map[*Variable]*editInfo
 	objective      *internal.Row
 	infeasibleRows *list.List
 	artificial     *internal.Row
+
+	goals map[*Objective]uint64
+
+	redundancies    []*Redundancy
+	rejectRedundant bool
+
+	hierarchical bool
+	levels       map[Priority]*internal.Row
+
+	quadratic *quadraticMode
+
+	// undo logs how to revert the changes other than of the tableau made while a Transaction or an atomic
+	// operation is in progress, scopes save the tableau as it was before
+	undo   []func()
+	scopes []*undoScope
+
+	recorder *Recorder
 }
 
 func NewSolver() *Solver {
 	return &Solver{
 		constraints:    make(map[*Constraint]*internal.Tag),
+		order:          make(map[*Constraint]uint64),
 		rows:           make(map[*internal.Symbol]*internal.Row),
 		variables:      make(map[*Variable]*internal.Symbol),
+		variableOrder:  make(map[*Variable]uint64),
+		references:     make(map[*Variable]int),
+		goals:          make(map[*Objective]uint64),
 		edits:          make(map[*Variable]*editInfo),
+		stays:          make(map[*Variable]*editInfo),
 		objective:      internal.NewRow(0.0),
 		infeasibleRows: list.New(),
 		artificial:     internal.NewRow(0.0),
@@ -42,10 +73,34 @@ func NewSolver() *Solver {
 }
 
 func (s *Solver) AddConstraint(constraint *Constraint) error {
+	err := s.addConstraint(constraint)
+	s.recorder.recordConstraints(opAdd, []*Constraint{constraint}, err)
+	return err
+}
+
+// addConstraint adds the constraint and optimizes the objective. If the objective becomes unbounded, the
+// tableau is restored as it was before, so the constraint is never left added on errors.
+func (s *Solver) addConstraint(constraint *Constraint) error {
+	return s.atomically(func() error {
+		if err := s.insertConstraint(constraint); err != nil {
+			return err
+		}
+		return s.optimize()
+	})
+}
+
+// insertConstraint adds the constraint to the tableau without optimizing the objective
+func (s *Solver) insertConstraint(constraint *Constraint) error {
 	if _, ok := s.constraints[constraint]; ok {
 		return errors.New("duplicate")
 	}
 
+	s.retainVariables(constraint)
+	rejected := func(err error) error {
+		s.releaseVariables(constraint)
+		return err
+	}
+
 	tag := &internal.Tag{
 		Marker: &internal.Symbol{internal.Invalid},
 		Other:  &internal.Symbol{internal.Invalid},
@@ -55,81 +110,123 @@ func (s *Solver) AddConstraint(constraint *Constraint) error {
 
 	subject := s.chooseSubjectForRow(row, tag)
 
+	var redundancy *Redundancy
+
 	if subject.Type == internal.Invalid && internal.CheckIfAllDummiesInRow(row) {
 		if !internal.IsNearZero(row.Constant) {
-			return errors.New("Unsatisfiable")
-		} else {
-			subject = tag.Marker
+			return rejected(errors.New("Unsatisfiable"))
+		}
+
+		redundancy = s.redundancyForRow(constraint, row, tag)
+		if s.rejectRedundant {
+			return rejected(&RedundancyError{redundancy})
 		}
+		subject = tag.Marker
 	}
 
 	if subject.Type == internal.Invalid {
 		if ok, err := s.addWithArtificalVariableOnRow(row); !ok {
 			if err != nil {
-				return err
+				return rejected(err)
 			}
-			return errors.New("Unsatisfiable")
+			return rejected(errors.New("Unsatisfiable"))
 		}
 	} else {
 		row.SolveForSymbol(subject)
 		s.substitute(subject, row)
+		s.saveBasis(subject)
 		s.rows[subject] = row
 	}
 
+	redundancies := len(s.redundancies)
+	s.logUndo(func() {
+		delete(s.constraints, constraint)
+		delete(s.order, constraint)
+		s.redundancies = s.redundancies[:redundancies]
+	})
+
 	s.constraints[constraint] = tag
+	s.order[constraint] = s.nextOrder
+	s.nextOrder++
 
-	return s.optimizeObjectiveRow(s.objective)
+	if redundancy != nil {
+		s.redundancies = append(s.redundancies, redundancy)
+	}
+
+	return nil
 }
 
 func (s *Solver) AddConstraints(constraints ...*Constraint) error {
-	applier := s.AddConstraint
-	undoer := s.RemoveConstraint
-
-	return s.bulkEdit(constraints, applier, undoer)
+	err := s.bulkEdit(constraints, s.addConstraint)
+	s.recorder.recordConstraints(opAddAll, constraints, err)
+	return err
 }
 
 func (s *Solver) RemoveConstraints(constraints ...*Constraint) error {
-	applier := s.RemoveConstraint
-	undoer := s.AddConstraint
-
-	return s.bulkEdit(constraints, applier, undoer)
+	err := s.bulkEdit(constraints, s.removeConstraint)
+	s.recorder.recordConstraints(opRemoveAll, constraints, err)
+	return err
 }
 
-func (s *Solver) bulkEdit(constraints []*Constraint, applier, undoer func(*Constraint) error) error {
-	needsCleanup := false
+// bulkEdit applies the applier to all constraints. If it fails for any of them, the changes applied
+// to the others are undone.
+func (s *Solver) bulkEdit(constraints []*Constraint, applier func(*Constraint) error) error {
+	return s.atomically(func() error {
+		for _, constraint := range constraints {
+			if err := applier(constraint); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	var result error
+func (s *Solver) RemoveConstraint(constraint *Constraint) error {
+	err := s.removeConstraint(constraint)
+	s.recorder.recordConstraints(opRemove, []*Constraint{constraint}, err)
+	return err
+}
 
-	for _, constraint := range constraints {
-		result = applier(constraint)
-		if result == nil {
-			defer func(c *Constraint) {
-				if needsCleanup {
-					undoer(c)
-				}
-			}(constraint)
-		} else {
-			needsCleanup = true
-			break
+// removeConstraint removes the constraint and optimizes the objective. If the remaining objective becomes
+// unbounded, the tableau is restored as it was before.
+func (s *Solver) removeConstraint(constraint *Constraint) error {
+	return s.atomically(func() error {
+		if err := s.dropConstraint(constraint); err != nil {
+			return err
 		}
-	}
-
-	return result
+		return s.optimize()
+	})
 }
 
-func (s *Solver) RemoveConstraint(constraint *Constraint) error {
+// dropConstraint removes the constraint from the tableau without optimizing the objective
+func (s *Solver) dropConstraint(constraint *Constraint) error {
 	tag, ok := s.constraints[constraint]
 	if !ok {
 		return errors.New("Unknown constraint")
 	}
 
+	if s.logsUndo() {
+		previous := tag
+		order := s.order[constraint]
+		redundancies := s.Redundancies()
+		s.logUndo(func() {
+			s.constraints[constraint] = previous
+			s.order[constraint] = order
+			s.redundancies = redundancies
+		})
+	}
+
 	tag = internal.FromTag(tag)
 	delete(s.constraints, constraint)
+	delete(s.order, constraint)
+	s.forgetRedundancies(constraint)
+	defer s.releaseVariables(constraint)
 
 	s.removeConstraintEffects(constraint, tag)
 
 	row, ok := s.rows[tag.Marker]
 	if ok {
+		s.saveBasis(tag.Marker)
 		delete(s.rows, tag.Marker)
 	} else {
 		leaving := s.leavingSymbolForMarkerSymbol(tag.Marker)
@@ -138,13 +235,205 @@ func (s *Solver) RemoveConstraint(constraint *Constraint) error {
 		}
 
 		row = s.rows[leaving]
+		s.saveBasis(leaving)
+		s.saveSolving(row, leaving)
 		delete(s.rows, leaving)
 
 		row.SolveForSymbols(leaving, tag.Marker)
 		s.substitute(tag.Marker, row)
 	}
 
-	return s.optimizeObjectiveRow(s.objective)
+	return nil
+}
+
+// SetConstraintPriority changes the priority of an already added constraint without removing it
+func (s *Solver) SetConstraintPriority(constraint *Constraint, priority Priority) error {
+	err := s.setConstraintPriority(constraint, priority)
+	s.recorder.recordPriority(constraint, priority, err)
+	return err
+}
+
+func (s *Solver) setConstraintPriority(constraint *Constraint, priority Priority) error {
+	tag, ok := s.constraints[constraint]
+	if !ok {
+		return errors.New("Unknown constraint")
+	}
+
+	if priority < 0 {
+		return errors.New("Bad Priority")
+	}
+
+	previous := constraint.Priority
+	if previous == priority {
+		return nil
+	}
+
+	if previous < PriorityRequired && priority < PriorityRequired {
+		// the error symbols stay the same, only their weight within the objective changes
+		return s.atomically(func() error {
+			s.removeConstraintEffects(constraint, tag)
+			constraint.Priority = priority
+			s.insertConstraintEffects(constraint, tag)
+			s.logUndo(func() {
+				constraint.Priority = previous
+			})
+
+			return s.optimize()
+		})
+	}
+
+	// required constraints are represented by different symbols, so the constraint has to be rebuilt.
+	// The objective is only optimized once it is complete again, as it may be unbounded in between.
+	// keep the variables of the constraint alive while it is rebuilt
+	s.retainVariables(constraint)
+	defer s.releaseVariables(constraint)
+
+	return s.atomically(func() error {
+		order := s.order[constraint]
+		if err := s.dropConstraint(constraint); err != nil {
+			return err
+		}
+
+		constraint.Priority = priority
+		s.logUndo(func() {
+			constraint.Priority = previous
+		})
+		if err := s.insertConstraint(constraint); err != nil {
+			return err
+		}
+		s.order[constraint] = order
+
+		return s.optimize()
+	})
+}
+
+// orderedConstraints returns all constraints of the Solver (including the ones of edit variables)
+// in the order they were added
+func (s *Solver) orderedConstraints() []*Constraint {
+	result := make([]*Constraint, 0, len(s.constraints))
+	for constraint := range s.constraints {
+		result = append(result, constraint)
+	}
+	s.sortConstraints(result)
+	return result
+}
+
+func (s *Solver) sortConstraints(constraints []*Constraint) {
+	sort.Slice(constraints, func(i, j int) bool {
+		return s.order[constraints[i]] < s.order[constraints[j]]
+	})
+}
+
+// UpdateConstraintConstant changes the constant of the expression of an already added constraint
+// without removing it. For a constraint like `width >= minWidth` the constant is `-minWidth`.
+func (s *Solver) UpdateConstraintConstant(constraint *Constraint, constant float64) error {
+	err := s.updateConstraintConstant(constraint, constant)
+	s.recorder.recordConstant(constraint, constant, err)
+	return err
+}
+
+func (s *Solver) updateConstraintConstant(constraint *Constraint, constant float64) error {
+	tag, ok := s.constraints[constraint]
+	if !ok {
+		return errors.New("Unknown constraint")
+	}
+
+	delta := constant - constraint.expression.constant
+	if delta == 0 {
+		return nil
+	}
+
+	markerCoefficient, otherCoefficient := markerCoefficients(constraint)
+
+	// if the new constant is unsatisfiable, the tableau is restored as it was before
+	return s.atomically(func() error {
+		if err := s.shiftConstant(tag, markerCoefficient, otherCoefficient, delta); err != nil {
+			return err
+		}
+		if err := s.dualOptimize(); err != nil {
+			return err
+		}
+
+		previous := constraint.expression.constant
+		constraint.expression.constant = constant
+		s.logUndo(func() {
+			constraint.expression.constant = previous
+		})
+		return nil
+	})
+}
+
+// markerCoefficients returns the coefficients of the marker and other symbols within the row
+// createRow builds for the constraint (before the sign of the row gets normalized).
+func markerCoefficients(c *Constraint) (float64, float64) {
+	switch c.relation {
+	case LessThanOrEqualTo:
+		return 1.0, -1.0
+	case GreaterThanOrEqualTo:
+		return -1.0, 1.0
+	}
+
+	if c.Priority < PriorityRequired {
+		return -1.0, 1.0
+	}
+	return 1.0, 0.0
+}
+
+// shiftConstant adds delta to the constant of the constraint row identified by tag. Instead of
+// rebuilding the row the change is absorbed by the marker (or other) symbol of the row, as the
+// constraint row reads `expression + constant + markerCoefficient*marker + otherCoefficient*other = 0`.
+func (s *Solver) shiftConstant(tag *internal.Tag, markerCoefficient, otherCoefficient, delta float64) error {
+	if row, ok := s.rows[tag.Marker]; ok {
+		s.saveConstant(row)
+		if tag.Marker.Type == internal.Dummy && !internal.IsNearZero(row.Constant-delta/markerCoefficient) {
+			return errors.New("Unsatisfiable")
+		}
+		if row.Add(-delta/markerCoefficient) < 0.0 {
+			s.infeasibleRows.PushBack(tag.Marker)
+		}
+		return nil
+	}
+
+	if otherCoefficient != 0.0 {
+		if row, ok := s.rows[tag.Other]; ok {
+			s.saveConstant(row)
+			if row.Add(-delta/otherCoefficient) < 0.0 {
+				s.infeasibleRows.PushBack(tag.Other)
+			}
+			return nil
+		}
+	}
+
+	if !s.shiftRowsContainingMarker(tag.Marker, delta/markerCoefficient) {
+		// a redundant constraint depends on this one, so the change would contradict it
+		s.shiftRowsContainingMarker(tag.Marker, -delta/markerCoefficient)
+		s.infeasibleRows.Init()
+		return errors.New("Unsatisfiable")
+	}
+
+	return nil
+}
+
+func (s *Solver) shiftRowsContainingMarker(marker *internal.Symbol, delta float64) bool {
+	consistent := true
+
+	for symbol, row := range s.rows {
+		coeff := row.CoefficientForSymbol(marker)
+		if coeff == 0.0 {
+			continue
+		}
+
+		s.saveConstant(row)
+		row.Add(delta * coeff)
+
+		if symbol.Type == internal.Dummy && !internal.IsNearZero(row.Constant) {
+			consistent = false
+		} else if row.Constant < 0.0 && symbol.Type != internal.External {
+			s.infeasibleRows.PushBack(symbol)
+		}
+	}
+
+	return consistent
 }
 
 func (s *Solver) leavingSymbolForMarkerSymbol(marker *internal.Symbol) *internal.Symbol {
@@ -187,20 +476,37 @@ func (s *Solver) leavingSymbolForMarkerSymbol(marker *internal.Symbol) *internal
 
 func (s *Solver) removeConstraintEffects(c *Constraint, tag *internal.Tag) {
 	if tag.Marker.Type == internal.Error {
-		s.removeMarkerEffects(tag.Marker, float64(c.Priority))
+		s.removeMarkerEffects(tag.Marker, c.Priority)
+	}
+	if tag.Other.Type == internal.Error {
+		s.removeMarkerEffects(tag.Other, c.Priority)
+	}
+}
+
+func (s *Solver) insertConstraintEffects(c *Constraint, tag *internal.Tag) {
+	if tag.Marker.Type == internal.Error {
+		s.insertMarkerEffects(tag.Marker, c.Priority, 1.0)
 	}
 	if tag.Other.Type == internal.Error {
-		s.removeMarkerEffects(tag.Other, float64(c.Priority))
+		s.insertMarkerEffects(tag.Other, c.Priority, 1.0)
 	}
 }
 
-func (s *Solver) removeMarkerEffects(marker *internal.Symbol, strength float64) {
+func (s *Solver) removeMarkerEffects(marker *internal.Symbol, priority Priority) {
+	s.insertMarkerEffects(marker, priority, -1.0)
+}
+
+func (s *Solver) insertMarkerEffects(marker *internal.Symbol, priority Priority, factor float64) {
+	objective, strength := s.objectiveFor(priority)
+
 	row, ok := s.rows[marker]
 
 	if ok {
-		s.objective.InsertRow(row, -strength)
+		s.saveInsertion(objective, nil, row)
+		objective.InsertRow(row, factor*strength)
 	} else {
-		s.objective.InsertSymbol(marker, -strength)
+		s.saveCell(objective, marker)
+		objective.InsertSymbol(marker, factor*strength)
 	}
 }
 
@@ -242,7 +548,10 @@ func (s *Solver) createRow(c *Constraint, tag *internal.Tag) *internal.Row {
 
 			tag.Other = error
 			row.InsertSymbol(error, -coefficient)
-			s.objective.InsertSymbol(error, float64(c.Priority))
+
+			objective, strength := s.objectiveFor(c.Priority)
+			s.saveCell(objective, error)
+			objective.InsertSymbol(error, strength)
 		}
 	case EqualTo:
 		if c.Priority < PriorityRequired {
@@ -253,8 +562,11 @@ func (s *Solver) createRow(c *Constraint, tag *internal.Tag) *internal.Row {
 			row.InsertSymbol(errPlus, -1.0)
 			row.InsertSymbol(errMinus, 1.0)
 
-			s.objective.InsertSymbol(errPlus, float64(c.Priority))
-			s.objective.InsertSymbol(errMinus, float64(c.Priority))
+			objective, strength := s.objectiveFor(c.Priority)
+			s.saveCell(objective, errPlus)
+			s.saveCell(objective, errMinus)
+			objective.InsertSymbol(errPlus, strength)
+			objective.InsertSymbol(errMinus, strength)
 		} else {
 			dummy := &internal.Symbol{internal.Dummy}
 			tag.Marker = dummy
@@ -293,10 +605,11 @@ func (s *Solver) chooseSubjectForRow(row *internal.Row, tag *internal.Tag) *inte
 
 func (s *Solver) addWithArtificalVariableOnRow(row *internal.Row) (bool, error) {
 	artificial := &internal.Symbol{internal.Slack}
+	s.saveBasis(artificial)
 	s.rows[artificial] = internal.CopyRow(row)
 	s.artificial = internal.CopyRow(row)
 
-	err := s.optimizeObjectiveRow(s.artificial)
+	err := s.optimizeObjectiveRow(s.artificial, false)
 	if err != nil {
 		return false, err
 	}
@@ -304,6 +617,14 @@ func (s *Solver) addWithArtificalVariableOnRow(row *internal.Row) (bool, error)
 	success := internal.IsNearZero(s.artificial.Constant)
 	s.artificial = internal.NewRow(0)
 
+	if !success {
+		// the artificial symbol is still basic and no other row mentions it, so dropping its row
+		// removes the constraint again. The pivots done so far only changed the basis, but the
+		// objective has to be optimized once more.
+		delete(s.rows, artificial)
+		return false, s.optimize()
+	}
+
 	if foundRow, ok := s.rows[artificial]; ok {
 		delete(s.rows, artificial)
 
@@ -316,78 +637,126 @@ func (s *Solver) addWithArtificalVariableOnRow(row *internal.Row) (bool, error)
 			return false, nil
 		}
 
+		s.saveSolving(foundRow, artificial)
 		foundRow.SolveForSymbols(artificial, entering)
 		s.substitute(entering, foundRow)
+		s.saveBasis(entering)
 		s.rows[entering] = foundRow
 	}
 
+	s.saveCellsContaining(artificial)
 	for _, row := range s.rows {
 		delete(row.Cells, artificial)
 	}
 	delete(s.objective.Cells, artificial)
+	for _, level := range s.levels {
+		delete(level.Cells, artificial)
+	}
 	return success, nil
 }
 
 func (s *Solver) substitute(symbol *internal.Symbol, row *internal.Row) {
 	for key, secRow := range s.rows {
-		secRow.Substitute(symbol, row)
+		if _, ok := secRow.Cells[symbol]; ok {
+			s.saveInsertion(secRow, symbol, row)
+			secRow.Substitute(symbol, row)
+		}
 
 		if key.Type != internal.External && secRow.Constant < 0.0 {
 			s.infeasibleRows.PushBack(key)
 		}
 	}
-	s.objective.Substitute(symbol, row)
+	s.substituteObjective(s.objective, symbol, row)
+	for _, level := range s.levels {
+		s.substituteObjective(level, symbol, row)
+	}
 
 	if s.artificial != nil {
 		s.artificial.Substitute(symbol, row)
 	}
 }
 
-func (s *Solver) optimizeObjectiveRow(objective *internal.Row) error {
+// substituteObjective substitutes the symbol within an objective row
+func (s *Solver) substituteObjective(objective *internal.Row, symbol *internal.Symbol, row *internal.Row) {
+	if _, ok := objective.Cells[symbol]; ok {
+		s.saveInsertion(objective, symbol, row)
+		objective.Substitute(symbol, row)
+	}
+}
+
+// optimizeObjectiveRow minimizes the given objective. Symbols which would change any of the
+// locked objectives are not considered for entering the basis. External symbols are only moved in
+// both directions if unrestricted is set, i.e. if the objective contains terms of objectives.
+func (s *Solver) optimizeObjectiveRow(objective *internal.Row, unrestricted bool, locked ...*internal.Row) error {
 
 	for true {
-		entering := s.enteringSymbolForObjectiveRow(objective)
+		entering := s.enteringSymbolForObjectiveRow(objective, unrestricted, locked)
 		if entering.Type == internal.Invalid {
 			return nil
 		}
 
-		leaving := s.leavingSymbolForEnteringSymbol(entering)
+		// external symbols are unrestricted, so they may also improve the objective by decreasing
+		direction := 1.0
+		if objective.CoefficientForSymbol(entering) > 0.0 {
+			direction = -1.0
+		}
+
+		leaving := s.leavingSymbolForEnteringSymbol(entering, direction)
 		if leaving == nil {
-			panic("UNDEFINED symbol!")
+			return errors.New("Unbounded objective")
 		}
 
 		row, _ := s.rows[leaving]
 
+		s.saveBasis(leaving)
+		s.saveSolving(row, leaving)
 		delete(s.rows, leaving)
 
 		row.SolveForSymbols(leaving, entering)
 
 		s.substitute(entering, row)
+		s.saveBasis(entering)
 		s.rows[entering] = row
 	}
 
 	return errors.New("Never ever")
 }
 
-func (s *Solver) enteringSymbolForObjectiveRow(objective *internal.Row) *internal.Symbol {
+func (s *Solver) enteringSymbolForObjectiveRow(objective *internal.Row, unrestricted bool, locked []*internal.Row) *internal.Symbol {
+outer:
 	for symbol, val := range objective.Cells {
-		if symbol.Type != internal.Dummy && val < 0.0 {
+		if symbol.Type == internal.Dummy {
+			continue
+		}
+		if val < 0.0 || (unrestricted && symbol.Type == internal.External && !internal.IsNearZero(val)) {
+			for _, other := range locked {
+				if !internal.IsNearZero(other.CoefficientForSymbol(symbol)) {
+					continue outer
+				}
+			}
 			return symbol
 		}
 	}
 	return &internal.Symbol{internal.Invalid}
 }
 
-func (s *Solver) leavingSymbolForEnteringSymbol(entering *internal.Symbol) *internal.Symbol {
+// leavingSymbolForEnteringSymbol returns the basic symbol which limits changing the entering symbol
+// in the given direction (1 for increasing, -1 for decreasing) the most
+func (s *Solver) leavingSymbolForEnteringSymbol(entering *internal.Symbol, direction float64) *internal.Symbol {
+	return leavingSymbolWithinRows(s.rows, entering, direction)
+}
+
+// leavingSymbolWithinRows is leavingSymbolForEnteringSymbol for the given rows of a tableau
+func leavingSymbolWithinRows(rows map[*internal.Symbol]*internal.Row, entering *internal.Symbol, direction float64) *internal.Symbol {
 	ratio := math.MaxFloat64
 	var result *internal.Symbol
 
-	for symbol, row := range s.rows {
+	for symbol, row := range rows {
 		if symbol.Type == internal.External {
 			continue
 		}
 
-		temp := row.CoefficientForSymbol(entering)
+		temp := row.CoefficientForSymbol(entering) * direction
 		if temp < 0 {
 			tempRatio := -row.Constant / temp
 			if tempRatio < ratio {
@@ -408,11 +777,28 @@ func (s *Solver) symbolForVariable(v *Variable) *internal.Symbol {
 	}
 
 	symbol = &internal.Symbol{internal.External}
-	s.variables[v] = symbol
+	s.registerVariable(v, symbol)
 	return symbol
 }
 
+func (s *Solver) registerVariable(v *Variable, symbol *internal.Symbol) {
+	s.variables[v] = symbol
+	s.variableOrder[v] = s.nextOrder
+	s.nextOrder++
+	s.logUndo(func() {
+		delete(s.variables, v)
+		delete(s.variableOrder, v)
+	})
+}
+
 func (s *Solver) AddEditVariable(v *Variable, priority float64) error {
+	err := s.addEditVariable(v, priority, s.quadratic)
+	s.recorder.recordEdit(v, Priority(priority), err)
+	return err
+}
+
+// addEditVariable adds the edit variable, approximating its error by the given quadratic mode
+func (s *Solver) addEditVariable(v *Variable, priority float64, mode *quadraticMode) error {
 	if _, ok := s.edits[v]; ok {
 		return errors.New("DUPLICATE")
 	}
@@ -421,10 +807,46 @@ func (s *Solver) AddEditVariable(v *Variable, priority float64) error {
 		return errors.New("Bad Priority")
 	}
 
+	info, err := s.newEditInfo(v, Priority(priority), mode)
+	if err != nil {
+		return err
+	}
+
+	s.edits[v] = info
+	s.logUndo(func() {
+		delete(s.edits, v)
+	})
+
+	return nil
+}
+
+// RemoveEditVariable removes the edit variable, leaving the variable to its constraints and stays
+func (s *Solver) RemoveEditVariable(v *Variable) error {
+	err := s.removeEditVariable(v)
+	s.recorder.recordVariable(opRemoveEdit, v, err)
+	return err
+}
+
+func (s *Solver) removeEditVariable(v *Variable) error {
+	info, ok := s.edits[v]
+	if !ok {
+		return errors.New("Unknown edit variable")
+	}
+
+	delete(s.edits, v)
+	s.logUndo(func() {
+		s.edits[v] = info
+	})
+	return s.removeEditInfo(info)
+}
+
+// newEditInfo adds the soft constraint `v == constant` used by edit variables and stays, together with the
+// bands of the quadratic mode
+func (s *Solver) newEditInfo(v *Variable, priority Priority, mode *quadraticMode) (*editInfo, error) {
 	constraint := NewConstraint(NewExpression([]*Term{NewTerm(v, 1.0)}, 0.0), EqualTo)
-	constraint.Priority = Priority(priority)
+	constraint.Priority = priority
 
-	s.AddConstraint(constraint)
+	s.addConstraint(constraint)
 
 	info := &editInfo{
 		tag:        s.constraints[constraint],
@@ -432,9 +854,21 @@ func (s *Solver) AddEditVariable(v *Variable, priority float64) error {
 		constant:   0.0,
 	}
 
-	s.edits[v] = info
+	if err := s.addBands(v, info, mode); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return info, nil
+}
+
+// removeEditInfo removes the constraints of an edit variable or stay
+func (s *Solver) removeEditInfo(info *editInfo) error {
+	for _, band := range info.bands {
+		if err := s.removeConstraint(band); err != nil {
+			return err
+		}
+	}
+	return s.removeConstraint(info.constraint)
 }
 
 func (s *Solver) SuggestValueForVariable(v *Variable, value float64) {
@@ -447,40 +881,39 @@ func (s *Solver) SuggestValueForVariable(v *Variable, value float64) {
 	s.suggestValueForEditInfoWithoutDualOptimization(edit, value)
 
 	s.dualOptimize()
+
+	s.recorder.recordSuggestion(v, value)
 }
 
 func (s *Solver) suggestValueForEditInfoWithoutDualOptimization(info *editInfo, val float64) {
-	delta := val - info.constant
+	previous := info.constant
+	delta := val - previous
 	info.constant = val
+	s.logUndo(func() {
+		info.constant = previous
+	})
 
-	{
-		symbol := info.tag.Marker
-		row, ok := s.rows[symbol]
-
-		if ok {
-			if row.Add(-delta) < 0.0 {
-				s.infeasibleRows.PushBack(symbol)
-			}
-			return
-		}
+	// the edit constraint `v == val` has the constant -val and the error symbols as marker and other
+	s.shiftConstant(info.tag, -1.0, 1.0, -delta)
 
-		symbol = info.tag.Other
-		row, ok = s.rows[symbol]
+	for _, band := range info.bands {
+		markerCoefficient, otherCoefficient := markerCoefficients(band)
+		s.shiftConstant(s.constraints[band], markerCoefficient, otherCoefficient, -delta)
+	}
+}
 
-		if ok {
-			if row.Add(delta) < 0.0 {
-				s.infeasibleRows.PushBack(symbol)
-			}
-			return
-		}
+// ValueOf returns the current value of the variable within the tableau without updating the variable
+// itself. Unknown variables have the value 0.
+func (s *Solver) ValueOf(v *Variable) float64 {
+	symbol, ok := s.variables[v]
+	if !ok {
+		return 0
 	}
 
-	for symbol, row := range s.rows {
-		coeff := row.CoefficientForSymbol(info.tag.Marker)
-		if coeff != 0.0 && row.Add(delta*coeff) < 0.0 && symbol.Type != internal.External {
-			s.infeasibleRows.PushBack(symbol)
-		}
+	if row, ok := s.rows[symbol]; ok {
+		return row.Constant
 	}
+	return 0
 }
 
 type Update struct {
@@ -506,9 +939,13 @@ func (s *Solver) FlushUpdates() []*Update {
 		}
 	}
 
+	s.updateStays()
+
+	s.recorder.recordFlush(s)
+
 	return result
 }
-func (s *Solver) dualOptimize() {
+func (s *Solver) dualOptimize() error {
 	for s.infeasibleRows.Len() > 0 {
 		e := s.infeasibleRows.Back()
 		s.infeasibleRows.Remove(e)
@@ -519,28 +956,43 @@ func (s *Solver) dualOptimize() {
 
 		if ok && row.Constant < 0.0 {
 			entering := s.dualEnteringSymbolForRow(row)
+			if entering == nil {
+				s.infeasibleRows.Init()
+				return errors.New("Unsatisfiable")
+			}
 
+			s.saveBasis(leaving)
+			s.saveSolving(row, leaving)
 			delete(s.rows, leaving)
 
 			row.SolveForSymbols(leaving, entering)
 			s.substitute(entering, row)
+			s.saveBasis(entering)
 			s.rows[entering] = row
 		}
 	}
+
+	return nil
 }
 
 func (s *Solver) dualEnteringSymbolForRow(row *internal.Row) *internal.Symbol {
 	var entering *internal.Symbol
 
-	ratio := math.MaxFloat64
+	objectives := s.objectives()
+	ratio := make([]float64, len(objectives))
+	for i := range ratio {
+		ratio[i] = math.MaxFloat64
+	}
+	r := make([]float64, len(objectives))
 
 	for symbol, val := range row.Cells {
 
 		if val > 0 && symbol.Type != internal.Dummy {
-			coeff := s.objective.CoefficientForSymbol(symbol)
-			r := coeff / val
-			if r < ratio {
-				ratio = r
+			for i, objective := range objectives {
+				r[i] = objective.CoefficientForSymbol(symbol) / val
+			}
+			if lexicographicallyLess(r, ratio) {
+				copy(ratio, r)
 				entering = symbol
 			}
 		}
@@ -0,0 +1,220 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is an immutable copy of the complete state of a Solver: its constraints, tableau,
+// objective and edit variables. It can be restored any number of times, e.g. to implement undo
+// and redo or to try out changes speculatively.
+type Snapshot struct {
+	solver *Solver
+	state  *solverState
+}
+
+// Snapshot captures the current state of the Solver
+func (s *Solver) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		solver: s,
+		state:  s.captureState(),
+	}
+	s.recorder.recordHandle(opSnapshot, snapshot, nil)
+	return snapshot
+}
+
+// Restore resets the Solver to a Snapshot previously taken from it. Variables are updated
+// with the next call to FlushUpdates.
+func (s *Solver) Restore(snapshot *Snapshot) error {
+	if snapshot == nil || snapshot.solver != s {
+		err := errors.New("Snapshot does not belong to this solver")
+		s.recorder.recordHandle(opRestore, snapshot, err)
+		return err
+	}
+
+	if s.logsUndo() {
+		// all rows get replaced by copies, so only the basis has to be saved
+		for symbol := range s.rows {
+			s.saveBasis(symbol)
+		}
+		for symbol := range snapshot.state.rows {
+			s.saveBasis(symbol)
+		}
+		previous := s.captureState()
+
+		// restoring the snapshot changes its constraints and editInfos, even the ones not in use right now
+		constraints := make(map[*Constraint]constraintState, len(snapshot.state.constraints))
+		for constraint := range snapshot.state.constraints {
+			constraints[constraint] = constraintState{
+				priority: constraint.Priority,
+				constant: constraint.expression.constant,
+			}
+		}
+		infos := make(map[*editInfo]editInfo)
+		for _, saved := range snapshot.state.edits {
+			infos[saved.info] = *saved.info
+		}
+		for _, saved := range snapshot.state.stays {
+			infos[saved.info] = *saved.info
+		}
+		s.logUndo(func() {
+			for constraint, state := range constraints {
+				constraint.Priority = state.priority
+				constraint.expression.constant = state.constant
+			}
+			for info, fields := range infos {
+				*info = fields
+			}
+			s.restoreState(previous)
+		})
+	}
+	s.restoreState(snapshot.state)
+	s.recorder.recordHandle(opRestore, snapshot, nil)
+	return nil
+}
+
+type constraintState struct {
+	tag      *internal.Tag
+	order    uint64
+	priority Priority
+	constant float64
+}
+
+// solverState is a deep copy of everything a Solver changes while constraints are added, removed or edited.
+// Symbols and tags are never modified once created, so they are shared instead of copied.
+type solverState struct {
+	constraints   map[*Constraint]constraintState
+	rows          map[*internal.Symbol]*internal.Row
+	variables     map[*Variable]*internal.Symbol
+	variableOrder map[*Variable]uint64
+	edits         map[*Variable]savedEditInfo
+	stays         map[*Variable]savedEditInfo
+	objective     *internal.Row
+	levels        map[Priority]*internal.Row
+	goals         map[*Objective]uint64
+	redundancies  []*Redundancy
+	nextOrder     uint64
+}
+
+// savedEditInfo keeps an editInfo together with its fields at the time the state was captured. Restoring
+// the state reuses the editInfo itself, as the undo log of a Transaction may refer to it.
+type savedEditInfo struct {
+	info   *editInfo
+	fields editInfo
+}
+
+func (s *Solver) captureState() *solverState {
+	state := &solverState{
+		constraints:   make(map[*Constraint]constraintState, len(s.constraints)),
+		rows:          copyRows(s.rows),
+		variables:     make(map[*Variable]*internal.Symbol, len(s.variables)),
+		variableOrder: make(map[*Variable]uint64, len(s.variables)),
+		edits:         make(map[*Variable]savedEditInfo, len(s.edits)),
+		stays:         make(map[*Variable]savedEditInfo, len(s.stays)),
+		objective:     internal.CopyRow(s.objective),
+		levels:        copyLevels(s.levels),
+		goals:         make(map[*Objective]uint64, len(s.goals)),
+		redundancies:  make([]*Redundancy, len(s.redundancies)),
+		nextOrder:     s.nextOrder,
+	}
+
+	for constraint, tag := range s.constraints {
+		state.constraints[constraint] = constraintState{
+			tag:      tag,
+			order:    s.order[constraint],
+			priority: constraint.Priority,
+			constant: constraint.expression.constant,
+		}
+	}
+	for variable, symbol := range s.variables {
+		state.variables[variable] = symbol
+		state.variableOrder[variable] = s.variableOrder[variable]
+	}
+	for variable, info := range s.edits {
+		state.edits[variable] = savedEditInfo{info, *info}
+	}
+	for variable, info := range s.stays {
+		state.stays[variable] = savedEditInfo{info, *info}
+	}
+	for objective, order := range s.goals {
+		state.goals[objective] = order
+	}
+	copy(state.redundancies, s.redundancies)
+
+	return state
+}
+
+// restoreState resets the Solver to the captured state. The state itself is left untouched, so
+// it may be restored again later on.
+func (s *Solver) restoreState(state *solverState) {
+	s.constraints = make(map[*Constraint]*internal.Tag, len(state.constraints))
+	s.order = make(map[*Constraint]uint64, len(state.constraints))
+	for constraint, constraintState := range state.constraints {
+		s.constraints[constraint] = constraintState.tag
+		s.order[constraint] = constraintState.order
+		constraint.Priority = constraintState.priority
+		constraint.expression.constant = constraintState.constant
+	}
+
+	s.rows = copyRows(state.rows)
+
+	s.variables = make(map[*Variable]*internal.Symbol, len(state.variables))
+	s.variableOrder = make(map[*Variable]uint64, len(state.variables))
+	for variable, symbol := range state.variables {
+		s.variables[variable] = symbol
+		s.variableOrder[variable] = state.variableOrder[variable]
+	}
+
+	s.edits = restoreEditInfos(state.edits)
+	s.stays = restoreEditInfos(state.stays)
+
+	s.objective = internal.CopyRow(state.objective)
+	s.levels = copyLevels(state.levels)
+
+	s.goals = make(map[*Objective]uint64, len(state.goals))
+	for objective, order := range state.goals {
+		s.goals[objective] = order
+	}
+
+	s.redundancies = make([]*Redundancy, len(state.redundancies))
+	copy(s.redundancies, state.redundancies)
+	s.nextOrder = state.nextOrder
+	s.countReferences()
+
+	s.infeasibleRows.Init()
+	s.artificial = internal.NewRow(0.0)
+}
+
+// restoreEditInfos returns the edit variables or stays of a state with their fields restored
+func restoreEditInfos(infos map[*Variable]savedEditInfo) map[*Variable]*editInfo {
+	result := make(map[*Variable]*editInfo, len(infos))
+	for variable, saved := range infos {
+		*saved.info = saved.fields
+		result[variable] = saved.info
+	}
+	return result
+}
+
+func copyRows(rows map[*internal.Symbol]*internal.Row) map[*internal.Symbol]*internal.Row {
+	result := make(map[*internal.Symbol]*internal.Row, len(rows))
+	for symbol, row := range rows {
+		result[symbol] = internal.CopyRow(row)
+	}
+	return result
+}
+
+func copyLevels(levels map[Priority]*internal.Row) map[Priority]*internal.Row {
+	if levels == nil {
+		return nil
+	}
+
+	result := make(map[Priority]*internal.Row, len(levels))
+	for priority, row := range levels {
+		result[priority] = internal.CopyRow(row)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// AddStay keeps the variable near its current value with the given priority. Every FlushUpdates moves
+// the stay to the flushed value, so the variable resists changes which are not required by other
+// constraints or edit variables.
+func (s *Solver) AddStay(v *Variable, priority Priority) error {
+	err := s.addStay(v, priority, s.quadratic)
+	s.recorder.recordStay(opStay, v, priority, err)
+	return err
+}
+
+// addStay adds the stay, approximating its error by the given quadratic mode
+func (s *Solver) addStay(v *Variable, priority Priority, mode *quadraticMode) error {
+	if _, ok := s.stays[v]; ok {
+		return errors.New("DUPLICATE")
+	}
+
+	if priority < 0 || priority >= PriorityRequired {
+		return errors.New("Bad Priority")
+	}
+
+	info, err := s.newEditInfo(v, priority, mode)
+	if err != nil {
+		return err
+	}
+	s.stays[v] = info
+	s.logUndo(func() {
+		delete(s.stays, v)
+	})
+
+	s.suggestValueForEditInfoWithoutDualOptimization(info, v.Value)
+	return s.dualOptimize()
+}
+
+// RemoveStay removes the stay of the variable
+func (s *Solver) RemoveStay(v *Variable) error {
+	err := s.removeStay(v)
+	s.recorder.recordStay(opRemoveStay, v, 0, err)
+	return err
+}
+
+func (s *Solver) removeStay(v *Variable) error {
+	info, ok := s.stays[v]
+	if !ok {
+		return errors.New("Unknown stay")
+	}
+
+	delete(s.stays, v)
+	s.logUndo(func() {
+		s.stays[v] = info
+	})
+	return s.removeEditInfo(info)
+}
+
+// Stays returns all stays of the Solver in the order they were added. Value is the value the variable
+// is kept at.
+func (s *Solver) Stays() []*EditVariable {
+	result := make([]*EditVariable, 0, len(s.stays))
+	for variable, info := range s.stays {
+		result = append(result, &EditVariable{
+			Variable: variable,
+			Priority: info.constraint.Priority,
+			Value:    info.constant,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return s.order[s.stays[result[i].Variable].constraint] < s.order[s.stays[result[j].Variable].constraint]
+	})
+	return result
+}
+
+// updateStays moves all stays to the values just flushed
+func (s *Solver) updateStays() {
+	if len(s.stays) == 0 {
+		return
+	}
+
+	for variable, info := range s.stays {
+		s.suggestValueForEditInfoWithoutDualOptimization(info, variable.Value)
+	}
+	s.dualOptimize()
+}
+
+// internalConstraints returns the constraints the Solver created for its edit variables and stays
+func (s *Solver) internalConstraints() map[*Constraint]bool {
+	result := make(map[*Constraint]bool, len(s.edits)+len(s.stays))
+	for _, infos := range []map[*Variable]*editInfo{s.edits, s.stays} {
+		for _, info := range infos {
+			result[info.constraint] = true
+			for _, band := range info.bands {
+				result[band] = true
+			}
+		}
+	}
+	return result
+}
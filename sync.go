@@ -0,0 +1,275 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sync"
+)
+
+// SyncSolver guards a Solver for concurrent use. Operations changing the Solver are serialized,
+// reads may run concurrently to each other.
+//
+// FlushUpdates writes the Value field of the variables, so concurrent readers should use ValueOf
+// or Values instead of reading the variables directly.
+type SyncSolver struct {
+	mutex  sync.RWMutex
+	solver *Solver
+}
+
+// NewSyncSolver wraps the Solver, which must not be used directly afterwards. If solver is nil,
+// a new Solver is created.
+func NewSyncSolver(solver *Solver) *SyncSolver {
+	if solver == nil {
+		solver = NewSolver()
+	}
+	return &SyncSolver{solver: solver}
+}
+
+// Update runs fn with exclusive access to the Solver, e.g. to apply several changes atomically or
+// to use a Transaction. The Solver must not be retained after fn returns.
+func (s *SyncSolver) Update(fn func(*Solver) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return fn(s.solver)
+}
+
+// View runs fn with read access to the Solver. fn must not change the Solver.
+func (s *SyncSolver) View(fn func(*Solver)) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	fn(s.solver)
+}
+
+func (s *SyncSolver) AddConstraint(constraint *Constraint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.AddConstraint(constraint)
+}
+
+func (s *SyncSolver) AddConstraints(constraints ...*Constraint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.AddConstraints(constraints...)
+}
+
+func (s *SyncSolver) RemoveConstraint(constraint *Constraint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveConstraint(constraint)
+}
+
+func (s *SyncSolver) RemoveConstraints(constraints ...*Constraint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveConstraints(constraints...)
+}
+
+func (s *SyncSolver) RemoveVariable(v *Variable) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveVariable(v)
+}
+
+func (s *SyncSolver) SetConstraintPriority(constraint *Constraint, priority Priority) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.SetConstraintPriority(constraint, priority)
+}
+
+func (s *SyncSolver) UpdateConstraintConstant(constraint *Constraint, constant float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.UpdateConstraintConstant(constraint, constant)
+}
+
+func (s *SyncSolver) AddEditVariable(v *Variable, priority float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.AddEditVariable(v, priority)
+}
+
+func (s *SyncSolver) RemoveEditVariable(v *Variable) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveEditVariable(v)
+}
+
+func (s *SyncSolver) AddStay(v *Variable, priority Priority) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.AddStay(v, priority)
+}
+
+func (s *SyncSolver) RemoveStay(v *Variable) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveStay(v)
+}
+
+func (s *SyncSolver) Minimize(expression *Expression, priority Priority) (*Objective, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.Minimize(expression, priority)
+}
+
+func (s *SyncSolver) Maximize(expression *Expression, priority Priority) (*Objective, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.Maximize(expression, priority)
+}
+
+func (s *SyncSolver) AddObjective(objective *Objective) (*Objective, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.AddObjective(objective)
+}
+
+func (s *SyncSolver) RemoveObjective(objective *Objective) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.RemoveObjective(objective)
+}
+
+func (s *SyncSolver) SuggestValueForVariable(v *Variable, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.solver.SuggestValueForVariable(v, value)
+}
+
+func (s *SyncSolver) SetRejectRedundant(reject bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.solver.SetRejectRedundant(reject)
+}
+
+func (s *SyncSolver) FlushUpdates() []*Update {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.FlushUpdates()
+}
+
+func (s *SyncSolver) FlushIntegralUpdates(nodeLimit int) ([]*Update, *IntegralReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.FlushIntegralUpdates(nodeLimit)
+}
+
+// Begin starts a Transaction whose Commit and Rollback take the lock as well. Rollback undoes all
+// changes made through the SyncSolver since Begin, including the ones of other goroutines.
+func (s *SyncSolver) Begin() *Transaction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx := s.solver.Begin()
+	tx.mutex = &s.mutex
+	return tx
+}
+
+// BeginEdit starts an EditSession whose methods take the lock as well, see Solver.BeginEdit
+func (s *SyncSolver) BeginEdit(variables map[*Variable]Priority) (*EditSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, err := s.solver.BeginEdit(variables)
+	if err != nil {
+		return nil, err
+	}
+	session.mutex = &s.mutex
+	return session, nil
+}
+
+func (s *SyncSolver) Snapshot() *Snapshot {
+	// taking a snapshot is recorded, so it needs exclusive access as well
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.Snapshot()
+}
+
+func (s *SyncSolver) Restore(snapshot *Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.solver.Restore(snapshot)
+}
+
+// ValueOf returns the current value of the variable, see Solver.ValueOf
+func (s *SyncSolver) ValueOf(v *Variable) float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.ValueOf(v)
+}
+
+// Values returns the current values of all given variables, read consistently from the same state
+func (s *SyncSolver) Values(variables ...*Variable) []float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make([]float64, len(variables))
+	for i, v := range variables {
+		result[i] = s.solver.ValueOf(v)
+	}
+	return result
+}
+
+// Bounds returns the feasible range of the variable, see Solver.Bounds. It only reads the Solver, so
+// it may run concurrently to other reads.
+func (s *SyncSolver) Bounds(v *Variable) (float64, float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Bounds(v)
+}
+
+func (s *SyncSolver) Sensitivity(constraint *Constraint) (*Sensitivity, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Sensitivity(constraint)
+}
+
+func (s *SyncSolver) ObjectiveValue() float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.ObjectiveValue()
+}
+
+func (s *SyncSolver) ObjectiveLevels() []*ObjectiveLevel {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.ObjectiveLevels()
+}
+
+func (s *SyncSolver) Constraints() []*Constraint {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Constraints()
+}
+
+func (s *SyncSolver) Variables() []*Variable {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Variables()
+}
+
+func (s *SyncSolver) EditVariables() []*EditVariable {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.EditVariables()
+}
+
+func (s *SyncSolver) Stays() []*EditVariable {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Stays()
+}
+
+func (s *SyncSolver) Objectives() []*Objective {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Objectives()
+}
+
+func (s *SyncSolver) Redundancies() []*Redundancy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.solver.Redundancies()
+}
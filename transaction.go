@@ -0,0 +1,300 @@
+// Copyright 2016 The Chromium Authors, 2018 Elco Industrie Automation GmbH. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package cassowary
+
+import (
+	"sync"
+
+	"github.com/monkey-works/cassowary/internal"
+	"github.com/pkg/errors"
+)
+
+// Transaction groups changes of a Solver. Every constraint, edit variable and suggested value changed
+// after Begin can be undone at once by Rollback, which returns to the exact previous tableau. Nothing
+// is copied when a Transaction begins, instead the Solver saves every cell of the tableau before changing
+// it for the first time and logs how to undo the other changes. Transactions may be nested; finishing a
+// Transaction finishes all Transactions begun after it the same way. Every Transaction has to be finished
+// by Commit or Rollback.
+type Transaction struct {
+	solver *Solver
+	scope  *undoScope
+
+	// mutex guards Commit and Rollback of Transactions begun by a SyncSolver
+	mutex sync.Locker
+}
+
+// undoScope collects what is needed to undo the changes made since a Transaction or an atomic operation
+// began: the rows of the basic symbols and the cells of the rows as they were before being changed first,
+// the objective rows, and the position within the undo log of the Solver.
+type undoScope struct {
+	mark      int
+	basis     map[*internal.Symbol]*internal.Row
+	cells     map[*internal.Row]*savedCells
+	objective *internal.Row
+	levels    map[Priority]*internal.Row
+}
+
+// savedCells holds the constant of a row and the coefficients of its cells before they were changed first.
+// Cells which did not exist are saved as 0.
+type savedCells struct {
+	constant     float64
+	coefficients map[*internal.Symbol]float64
+}
+
+// Begin starts a new Transaction on the Solver
+func (s *Solver) Begin() *Transaction {
+	tx := &Transaction{
+		solver: s,
+		scope:  s.beginUndo(),
+	}
+	s.recorder.recordHandle(opBegin, tx, nil)
+	return tx
+}
+
+// Commit keeps all changes made since the Transaction began
+func (tx *Transaction) Commit() error {
+	if tx.mutex != nil {
+		tx.mutex.Lock()
+		defer tx.mutex.Unlock()
+	}
+
+	if err := tx.solver.endUndo(tx.scope, false); err != nil {
+		return err
+	}
+	tx.solver.recorder.recordHandle(opCommit, tx, nil)
+	return nil
+}
+
+// Rollback undoes all changes made since the Transaction began
+func (tx *Transaction) Rollback() error {
+	if tx.mutex != nil {
+		tx.mutex.Lock()
+		defer tx.mutex.Unlock()
+	}
+
+	if err := tx.solver.endUndo(tx.scope, true); err != nil {
+		return err
+	}
+	tx.solver.recorder.recordHandle(opRollback, tx, nil)
+	return nil
+}
+
+// beginUndo starts saving the tableau changed from now on and logging how to undo all other changes.
+// The returned scope has to be passed to endUndo.
+func (s *Solver) beginUndo() *undoScope {
+	scope := &undoScope{
+		mark:      len(s.undo),
+		basis:     make(map[*internal.Symbol]*internal.Row),
+		cells:     make(map[*internal.Row]*savedCells),
+		objective: s.objective,
+	}
+	if s.levels != nil {
+		scope.levels = make(map[Priority]*internal.Row, len(s.levels))
+		for priority, level := range s.levels {
+			scope.levels[priority] = level
+		}
+	}
+	s.scopes = append(s.scopes, scope)
+	return scope
+}
+
+// endUndo finishes the scope and all scopes begun after it. If rollback is set, all their changes are
+// undone, otherwise they are handed to the enclosing scope. Once no scope is left, the log is dropped.
+func (s *Solver) endUndo(scope *undoScope, rollback bool) error {
+	index := len(s.scopes) - 1
+	for index >= 0 && s.scopes[index] != scope {
+		index--
+	}
+	if index < 0 {
+		return errors.New("Transaction already finished")
+	}
+
+	for i := len(s.scopes) - 1; i >= index; i-- {
+		inner := s.scopes[i]
+		s.scopes = s.scopes[:i]
+		if rollback {
+			s.rollbackScope(inner)
+		} else if i > 0 {
+			s.scopes[i-1].merge(inner)
+		}
+	}
+
+	if len(s.scopes) == 0 {
+		s.undo = nil
+	}
+	return nil
+}
+
+// merge hands the saved tableau of the inner scope to the enclosing one. Whatever the enclosing scope
+// did not save yet was unchanged when the inner scope began.
+func (scope *undoScope) merge(inner *undoScope) {
+	for symbol, row := range inner.basis {
+		if _, ok := scope.basis[symbol]; !ok {
+			scope.basis[symbol] = row
+		}
+	}
+
+	for row, saved := range inner.cells {
+		outer, ok := scope.cells[row]
+		if !ok {
+			scope.cells[row] = saved
+			continue
+		}
+		for symbol, coefficient := range saved.coefficients {
+			if _, ok := outer.coefficients[symbol]; !ok {
+				outer.coefficients[symbol] = coefficient
+			}
+		}
+	}
+}
+
+// rollbackScope undoes the logged changes in reverse order and puts the saved tableau back into place
+func (s *Solver) rollbackScope(scope *undoScope) {
+	steps := s.undo[scope.mark:]
+	s.undo = s.undo[:scope.mark]
+	for i := len(steps) - 1; i >= 0; i-- {
+		steps[i]()
+	}
+
+	for row, saved := range scope.cells {
+		row.Constant = saved.constant
+		for symbol, coefficient := range saved.coefficients {
+			if coefficient == 0.0 {
+				delete(row.Cells, symbol)
+			} else {
+				row.Cells[symbol] = coefficient
+			}
+		}
+	}
+	for symbol, row := range scope.basis {
+		if row == nil {
+			delete(s.rows, symbol)
+		} else {
+			s.rows[symbol] = row
+		}
+	}
+	s.objective = scope.objective
+	s.levels = scope.levels
+	s.infeasibleRows.Init()
+	s.artificial = internal.NewRow(0.0)
+}
+
+// logUndo logs how to undo a change of the Solver other than of its tableau, if a Transaction or an atomic
+// operation is in progress. Steps must not change the tableau, it is restored from the saved cells.
+func (s *Solver) logUndo(step func()) {
+	if s.logsUndo() {
+		s.undo = append(s.undo, step)
+	}
+}
+
+// logsUndo returns true if changes have to be logged, so callers can skip collecting what logUndo needs
+func (s *Solver) logsUndo() bool {
+	return len(s.scopes) > 0
+}
+
+// saveBasis saves the row of the symbol before it is inserted into or removed from the rows for the first
+// time within the current scope. Symbols without a row are saved as nil.
+func (s *Solver) saveBasis(symbol *internal.Symbol) {
+	if len(s.scopes) == 0 {
+		return
+	}
+
+	scope := s.scopes[len(s.scopes)-1]
+	if _, ok := scope.basis[symbol]; !ok {
+		scope.basis[symbol] = s.rows[symbol]
+	}
+}
+
+// savedCellsOf returns the saved cells of the row within the current scope, saving its constant first
+// if needed. It returns nil if nothing has to be saved.
+func (s *Solver) savedCellsOf(row *internal.Row) *savedCells {
+	if len(s.scopes) == 0 || row == s.artificial {
+		return nil
+	}
+
+	scope := s.scopes[len(s.scopes)-1]
+	saved, ok := scope.cells[row]
+	if !ok {
+		saved = &savedCells{
+			constant:     row.Constant,
+			coefficients: make(map[*internal.Symbol]float64),
+		}
+		scope.cells[row] = saved
+	}
+	return saved
+}
+
+// save saves the coefficient of the symbol within the row, unless it is saved already
+func (saved *savedCells) save(row *internal.Row, symbol *internal.Symbol) {
+	if _, ok := saved.coefficients[symbol]; !ok {
+		saved.coefficients[symbol] = row.Cells[symbol]
+	}
+}
+
+// saveConstant saves the constant of the row before it is changed
+func (s *Solver) saveConstant(row *internal.Row) {
+	s.savedCellsOf(row)
+}
+
+// saveCell saves the row before the coefficient of the symbol is changed
+func (s *Solver) saveCell(row *internal.Row, symbol *internal.Symbol) {
+	if saved := s.savedCellsOf(row); saved != nil {
+		saved.save(row, symbol)
+	}
+}
+
+// saveInsertion saves the row before the other row is inserted into it in place of the symbol, as done by
+// Substitute and InsertRow. The symbol may be nil.
+func (s *Solver) saveInsertion(row *internal.Row, symbol *internal.Symbol, other *internal.Row) {
+	saved := s.savedCellsOf(row)
+	if saved == nil {
+		return
+	}
+
+	if symbol != nil {
+		saved.save(row, symbol)
+	}
+	for cell := range other.Cells {
+		saved.save(row, cell)
+	}
+}
+
+// saveSolving saves the row before it is solved for the entering symbol in place of the leaving one
+func (s *Solver) saveSolving(row *internal.Row, leaving *internal.Symbol) {
+	saved := s.savedCellsOf(row)
+	if saved == nil {
+		return
+	}
+
+	saved.save(row, leaving)
+	for cell := range row.Cells {
+		saved.save(row, cell)
+	}
+}
+
+// saveCellsContaining saves all rows of the tableau and the objectives before the symbol is removed from them
+func (s *Solver) saveCellsContaining(symbol *internal.Symbol) {
+	if len(s.scopes) == 0 {
+		return
+	}
+
+	for _, row := range s.rows {
+		if _, ok := row.Cells[symbol]; ok {
+			s.saveCell(row, symbol)
+		}
+	}
+	s.saveCell(s.objective, symbol)
+	for _, level := range s.levels {
+		s.saveCell(level, symbol)
+	}
+}
+
+// atomically runs fn and undoes all of its changes if it fails
+func (s *Solver) atomically(fn func() error) error {
+	scope := s.beginUndo()
+	err := fn()
+	s.endUndo(scope, err != nil)
+	return err
+}
@@ -9,6 +9,9 @@ type Variable struct {
 
 	Name string
 
+	// Integral marks variables which get integral values from Solver.FlushIntegralUpdates
+	Integral bool
+
 	owner *Param
 }
 